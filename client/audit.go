@@ -0,0 +1,365 @@
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default values used by AuditLog when the corresponding fields are not set.
+const (
+	DefaultAuditMaxSize    = 100 << 20
+	DefaultAuditMaxBackups = 5
+)
+
+// The stages of a mutating request recorded by the AuditLog.
+const (
+	AuditStageRequest  = "request"
+	AuditStageResponse = "response"
+)
+
+// auditMaxIdentities is the number of the token identities kept by the
+// AuditLog. The least recently used ones are evicted.
+const auditMaxIdentities = 100
+
+// AuditRecord is a single mutating request recorded by the AuditLog.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Stage is AuditStageRequest for the record written before the request
+	// is sent, and AuditStageResponse for the record of its outcome.
+	Stage       string `json:"stage"`
+	Cloud       string `json:"cloud,omitempty"`
+	Region      string `json:"region,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	UserName    string `json:"user_name,omitempty"`
+	ProjectID   string `json:"project_id,omitempty"`
+	ProjectName string `json:"project_name,omitempty"`
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Service     string `json:"service"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	// BodyDigest is the SHA-256 digest of the masked JSON body. Other
+	// bodies are not digested.
+	BodyDigest string `json:"body_digest,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AuditLog appends two JSON Lines records per mutating request into a file,
+// one before the request is sent and one with its outcome. The file is
+// rotated, when it exceeds the MaxSize, and the rotated files are
+// kept with the .1, .2, etc. suffixes.
+//
+// The user and the project are taken from the Keystone token responses, so
+// the requests authenticated with a token obtained by another client are
+// recorded without them.
+type AuditLog struct {
+	// Path is the JSON Lines file. It is created with the 0600 permissions.
+	Path string
+	// MaxSize is the file size in bytes, which triggers the rotation.
+	// Defaults to DefaultAuditMaxSize.
+	MaxSize int64
+	// MaxBackups is the number of the rotated files to keep. Defaults to
+	// DefaultAuditMaxBackups.
+	MaxBackups int
+	// Cloud and Region are copied into each record.
+	Cloud  string
+	Region string
+
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	lru        *list.List
+	identities map[string]*list.Element
+}
+
+// auditIdentityEntry is the identity of a hashed token.
+type auditIdentityEntry struct {
+	key      string
+	identity auditIdentity
+}
+
+// auditIdentity is the user and the project of a token.
+type auditIdentity struct {
+	userID      string
+	userName    string
+	projectID   string
+	projectName string
+}
+
+// NewAuditLog returns a new AuditLog writing into the path.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path}
+}
+
+// Write appends the record to the file.
+func (a *AuditLog) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.open(); err != nil {
+		return err
+	}
+
+	if a.size > 0 && a.size+int64(len(line)) > a.maxSize() {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// Close closes the file. The next Write opens it again.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+func (a *AuditLog) open() error {
+	if a.file != nil {
+		return nil
+	}
+	if a.Path == "" {
+		return fmt.Errorf("audit log path is empty")
+	}
+
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one and starts a new file.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.file = nil
+
+	maxBackups := a.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = DefaultAuditMaxBackups
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", a.Path, maxBackups))
+	for i := maxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.Path, i), fmt.Sprintf("%s.%d", a.Path, i+1))
+	}
+	if err := os.Rename(a.Path, a.Path+".1"); err != nil {
+		return err
+	}
+
+	return a.open()
+}
+
+func (a *AuditLog) maxSize() int64 {
+	if a.MaxSize > 0 {
+		return a.MaxSize
+	}
+	return DefaultAuditMaxSize
+}
+
+// tokenKey returns the hashed token in order to not keep it in memory.
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// learnIdentity extracts the user and the project from a Keystone v2 or v3
+// token response body.
+func (a *AuditLog) learnIdentity(response *http.Response, body []byte) {
+	var token struct {
+		Token struct {
+			User struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+			Project struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"project"`
+		} `json:"token"`
+		Access struct {
+			Token struct {
+				ID     string `json:"id"`
+				Tenant struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"tenant"`
+			} `json:"token"`
+			User struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"access"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return
+	}
+
+	var id string
+	var identity auditIdentity
+	if v := response.Header.Get("X-Subject-Token"); v != "" {
+		id = v
+		identity = auditIdentity{
+			userID:      token.Token.User.ID,
+			userName:    token.Token.User.Name,
+			projectID:   token.Token.Project.ID,
+			projectName: token.Token.Project.Name,
+		}
+	} else if v := token.Access.Token.ID; v != "" {
+		id = v
+		identity = auditIdentity{
+			userID:      token.Access.User.ID,
+			userName:    token.Access.User.Name,
+			projectID:   token.Access.Token.Tenant.ID,
+			projectName: token.Access.Token.Tenant.Name,
+		}
+	} else {
+		return
+	}
+
+	key := tokenKey(id)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.lru == nil {
+		a.lru = list.New()
+		a.identities = make(map[string]*list.Element)
+	}
+
+	if e, ok := a.identities[key]; ok {
+		e.Value = &auditIdentityEntry{key: key, identity: identity}
+		a.lru.MoveToFront(e)
+		return
+	}
+	a.identities[key] = a.lru.PushFront(&auditIdentityEntry{key: key, identity: identity})
+
+	// the tokens expire, drop the least recently used ones
+	for a.lru.Len() > auditMaxIdentities {
+		e := a.lru.Back()
+		a.lru.Remove(e)
+		delete(a.identities, e.Value.(*auditIdentityEntry).key)
+	}
+}
+
+func (a *AuditLog) identity(token string) auditIdentity {
+	if token == "" {
+		return auditIdentity{}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if e, ok := a.identities[tokenKey(token)]; ok {
+		a.lru.MoveToFront(e)
+		return e.Value.(*auditIdentityEntry).identity
+	}
+	return auditIdentity{}
+}
+
+// audit returns a step, which records the mutating requests into the audit
+// log. The requests are not sent, when their record cannot be written.
+func (rt *RoundTripper) audit(a *AuditLog, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		if isTokenRequest(request) {
+			response, err := next(request)
+			if err == nil && response.StatusCode < 300 && strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+				body, err := readResponseBody(response)
+				if err != nil {
+					return nil, err
+				}
+				a.learnIdentity(response, body)
+			}
+			return response, err
+		}
+
+		if isReadMethod(request.Method) {
+			return next(request)
+		}
+
+		identity := a.identity(request.Header.Get("X-Auth-Token"))
+		service, _ := rt.resolveService(request.URL)
+		record := AuditRecord{
+			Time:        time.Now().UTC(),
+			Cloud:       a.Cloud,
+			Region:      a.Region,
+			UserID:      identity.userID,
+			UserName:    identity.userName,
+			ProjectID:   identity.projectID,
+			ProjectName: identity.projectName,
+			Stage:       AuditStageRequest,
+			Method:      request.Method,
+			URL:         request.URL.String(),
+			Service:     service,
+		}
+
+		if isJSONRequest(request.Header.Get("Content-Type")) {
+			body, err := readRequestBody(request)
+			if err != nil {
+				return nil, err
+			}
+			if len(body) > 0 {
+				sum := sha256.Sum256([]byte(rt.compactJSON(body)))
+				record.BodyDigest = "sha256:" + hex.EncodeToString(sum[:])
+			}
+		}
+
+		if err := a.Write(record); err != nil {
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			return nil, fmt.Errorf("failed to write the audit log: %w", err)
+		}
+
+		response, err := next(request)
+		record.Time = time.Now().UTC()
+		record.Stage = AuditStageResponse
+		if response != nil {
+			record.StatusCode = response.StatusCode
+			record.RequestID = requestID(response.Header)
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		if e := a.Write(record); e != nil && rt.Logger != nil {
+			rt.log().Printf("Failed to write the audit record of %s %s: %v", record.Method, record.URL, e)
+		}
+
+		return response, err
+	}
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const auditTokenResponse = `{"token": {"user": {"id": "u1", "name": "jdoe"}, "project": {"id": "p1", "name": "demo"}, "catalog": []}}`
+
+func auditTransport() http.RoundTripper {
+	return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		if request.Body != nil {
+			io.Copy(io.Discard, request.Body)
+		}
+		if isTokenRequest(request) {
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Header: http.Header{
+					"Content-Type":    {"application/json"},
+					"X-Subject-Token": {"secret-token"},
+				},
+				Body:    io.NopCloser(strings.NewReader(auditTokenResponse)),
+				Request: request,
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusAccepted,
+			Header:     http.Header{"X-Openstack-Request-Id": {"req-1"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    request,
+		}, nil
+	})
+}
+
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	f, err := os.Open(path)
+	th.AssertNoErr(t, err)
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r AuditRecord
+		th.AssertNoErr(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := NewAuditLog(path)
+	audit.Cloud = "prod"
+	audit.Region = "RegionOne"
+	defer audit.Close()
+
+	rt := &RoundTripper{
+		Rt:    auditTransport(),
+		Audit: audit,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com:5000/v3/auth/tokens", strings.NewReader(`{"auth": {}}`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	request, _ = http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	request.Header.Set("X-Auth-Token", "secret-token")
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers", strings.NewReader(`{"server": {"name": "foo", "adminPass": "secret"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Auth-Token", "secret-token")
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	// the masked fields do not change the digest
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers", strings.NewReader(`{"server": {"name": "foo", "adminPass": "other"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	info, err := os.Stat(path)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, os.FileMode(0600), info.Mode().Perm())
+
+	records := readAuditRecords(t, path)
+	th.AssertEquals(t, 4, len(records))
+
+	// the request is recorded before it is sent
+	th.AssertEquals(t, AuditStageRequest, records[0].Stage)
+	th.AssertEquals(t, 0, records[0].StatusCode)
+	th.AssertEquals(t, "", records[0].RequestID)
+	th.AssertEquals(t, "u1", records[0].UserID)
+
+	r := records[1]
+	th.AssertEquals(t, AuditStageResponse, r.Stage)
+	th.AssertEquals(t, "prod", r.Cloud)
+	th.AssertEquals(t, "RegionOne", r.Region)
+	th.AssertEquals(t, "u1", r.UserID)
+	th.AssertEquals(t, "jdoe", r.UserName)
+	th.AssertEquals(t, "p1", r.ProjectID)
+	th.AssertEquals(t, "demo", r.ProjectName)
+	th.AssertEquals(t, http.MethodPost, r.Method)
+	th.AssertEquals(t, "http://example.com:8774/v2.1/servers", r.URL)
+	th.AssertEquals(t, "compute", r.Service)
+	th.AssertEquals(t, http.StatusAccepted, r.StatusCode)
+	th.AssertEquals(t, "req-1", r.RequestID)
+	th.AssertEquals(t, true, strings.HasPrefix(r.BodyDigest, "sha256:"))
+
+	th.AssertEquals(t, r.BodyDigest, records[0].BodyDigest)
+
+	// the unknown token has no identity
+	th.AssertEquals(t, "", records[3].UserID)
+	th.AssertEquals(t, r.BodyDigest, records[3].BodyDigest)
+}
+
+func TestAuditLogIdentities(t *testing.T) {
+	audit := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	learn := func(token string) {
+		response := &http.Response{Header: http.Header{"X-Subject-Token": {token}}}
+		audit.learnIdentity(response, []byte(auditTokenResponse))
+	}
+
+	for i := 0; i < auditMaxIdentities; i++ {
+		learn(fmt.Sprintf("token-%d", i))
+	}
+	th.AssertEquals(t, "u1", audit.identity("token-0").userID)
+
+	// the least recently used identity is evicted
+	learn("token-new")
+	th.AssertEquals(t, auditMaxIdentities, audit.lru.Len())
+	th.AssertEquals(t, "u1", audit.identity("token-0").userID)
+	th.AssertEquals(t, "", audit.identity("token-1").userID)
+	th.AssertEquals(t, "u1", audit.identity("token-2").userID)
+	th.AssertEquals(t, "u1", audit.identity("token-new").userID)
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit := &AuditLog{
+		Path:       path,
+		MaxSize:    300,
+		MaxBackups: 2,
+	}
+	defer audit.Close()
+
+	for i := 0; i < 10; i++ {
+		th.AssertNoErr(t, audit.Write(AuditRecord{
+			Method: http.MethodDelete,
+			URL:    "http://example.com:8774/v2.1/servers/1",
+		}))
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		th.AssertNoErr(t, err)
+		if info.Size() > 300 {
+			t.Fatalf("%s is larger than the max size: %d", p, info.Size())
+		}
+	}
+	_, err := os.Stat(path + ".3")
+	th.AssertEquals(t, true, os.IsNotExist(err))
+}
+
+func TestAuditLogUnwritable(t *testing.T) {
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt:    transport,
+		Audit: NewAuditLog(filepath.Join(t.TempDir(), "missing", "audit.jsonl")),
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, "http://example.com:8774/v2.1/servers/1", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertErr(t, err)
+	th.AssertEquals(t, 0, transport.calls)
+}
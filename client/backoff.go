@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+)
+
+// StatusPolicy defines how requests failed with a specific HTTP status code
+// are retried.
+type StatusPolicy struct {
+	// MaxRetries is the maximum number of retries. Zero disables retries for
+	// the status code. The counter is shared between all the status codes
+	// received within a single gophercloud request.
+	MaxRetries uint
+	// IdempotentOnly allows to retry only idempotent requests, because the
+	// status code doesn't guarantee the request wasn't applied by the server.
+	IdempotentOnly bool
+	// InitialDelay overrides BackoffOpts.InitialDelay for the status code.
+	InitialDelay time.Duration
+}
+
+// DefaultStatusPolicies is the per-status policy table used, when
+// BackoffOpts.Policies is nil.
+var DefaultStatusPolicies = map[int]StatusPolicy{
+	// Nova and Neutron return 409, when a resource is still in use or is in
+	// a transitional state.
+	http.StatusConflict:            {MaxRetries: 5},
+	http.StatusTooManyRequests:     {MaxRetries: 10},
+	http.StatusInternalServerError: {MaxRetries: 3, IdempotentOnly: true},
+	http.StatusBadGateway:          {MaxRetries: 5, IdempotentOnly: true},
+	http.StatusServiceUnavailable:  {MaxRetries: 5},
+	http.StatusGatewayTimeout:      {MaxRetries: 3, IdempotentOnly: true},
+}
+
+// BackoffOpts configures the status code aware retry functions, which can be
+// set as gophercloud.ProviderClient RetryBackoffFunc and RetryFunc. The
+// Retry-After response header is honored, when it is present. Otherwise the
+// delay grows exponentially with each retry.
+type BackoffOpts struct {
+	// InitialDelay is the delay before the first retry.
+	// Defaults to one second.
+	InitialDelay time.Duration
+	// MaxDelay caps a single sleep, including the one requested by the
+	// Retry-After header. Defaults to one minute.
+	MaxDelay time.Duration
+	// MaxTotalDelay is the total sleep budget of a single gophercloud
+	// request. Zero means no limit.
+	MaxTotalDelay time.Duration
+	// Multiplier is the factor the delay is multiplied by on each retry.
+	// Defaults to DefaultRetryMultiplier.
+	Multiplier float64
+	// Jitter is the randomization factor in the [0, 1] range applied to each
+	// calculated delay. Defaults to DefaultRetryJitter, a negative value
+	// disables the jitter.
+	Jitter float64
+	// Policies is the per-status policy table. Status codes missing in the
+	// table are not retried. Defaults to DefaultStatusPolicies.
+	Policies map[int]StatusPolicy
+	// Logger is used to report the retried requests.
+	Logger Logger
+}
+
+// RetryBackoffFunc returns a function to be set as a
+// gophercloud.ProviderClient RetryBackoffFunc. Gophercloud calls it only for
+// the 429 status code, use RetryFunc to cover other status codes.
+func (opts BackoffOpts) RetryBackoffFunc() gophercloud.RetryBackoffFunc {
+	return func(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, e error, retries uint) error {
+		if respErr == nil {
+			return e
+		}
+		if err := opts.backoff(ctx, respErr, retries); err != nil {
+			if e != nil {
+				return e
+			}
+			return *respErr
+		}
+		return nil
+	}
+}
+
+// RetryFunc returns a function to be set as a gophercloud.ProviderClient
+// RetryFunc. Only errors with an unexpected response code from the policy
+// table are retried, other errors are returned as is.
+func (opts BackoffOpts) RetryFunc() gophercloud.RetryFunc {
+	return func(ctx context.Context, method, url string, options *gophercloud.RequestOpts, err error, failCount uint) error {
+		var respErr gophercloud.ErrUnexpectedResponseCode
+		if !errors.As(err, &respErr) {
+			return err
+		}
+
+		// a raw body, which was already consumed, can be sent again only
+		// when it can be rewound
+		if options != nil && options.RawBody != nil {
+			seeker, ok := options.RawBody.(io.Seeker)
+			if !ok {
+				return err
+			}
+			if _, e := seeker.Seek(0, io.SeekStart); e != nil {
+				return err
+			}
+		}
+
+		if e := opts.backoff(ctx, &respErr, failCount); e != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// backoff sleeps before the next retry or returns an error, when the request
+// should not be retried.
+func (opts BackoffOpts) backoff(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, retries uint) error {
+	policies := opts.Policies
+	if policies == nil {
+		policies = DefaultStatusPolicies
+	}
+
+	policy, ok := policies[respErr.Actual]
+	if !ok || retries > policy.MaxRetries {
+		return errRetryNotAllowed
+	}
+	if policy.IdempotentOnly && !isIdempotentMethod(respErr.Method) {
+		return errRetryNotAllowed
+	}
+
+	initial := opts.InitialDelay
+	if policy.InitialDelay > 0 {
+		initial = policy.InitialDelay
+	}
+	if initial <= 0 {
+		initial = time.Second
+	}
+	max := opts.MaxDelay
+	if max <= 0 {
+		max = time.Minute
+	}
+
+	sleep, ok := retryAfter(respErr.ResponseHeader)
+	if !ok {
+		sleep = exponentialDelay(initial, max, opts.Multiplier, opts.Jitter, int(retries))
+	}
+	if sleep > max {
+		sleep = max
+	}
+
+	// The budget is calculated from the delays without jitter, since the
+	// sleeps of the previous retries are not known.
+	if opts.MaxTotalDelay > 0 {
+		var total time.Duration
+		for i := 1; i < int(retries); i++ {
+			total += exponentialDelay(initial, max, opts.Multiplier, -1, i)
+		}
+		if total+sleep > opts.MaxTotalDelay {
+			return errRetryNotAllowed
+		}
+	}
+
+	l := opts.Logger
+	if l != nil {
+		l.Printf("Received %d response code for %s %s (request ID: %s), retry number %d in %s", respErr.Actual, respErr.Method, respErr.URL, requestID(respErr.ResponseHeader), retries, sleep)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := sleepContext(ctx, sleep); err != nil {
+		if l != nil {
+			l.Printf("Sleeping aborted: %s", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// errRetryNotAllowed is returned, when the request must not be retried.
+var errRetryNotAllowed = errors.New("retry is not allowed")
+
+// retryAfter parses the Retry-After header as delay seconds or an HTTP date.
+func retryAfter(headers http.Header) (time.Duration, bool) {
+	v := headers.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if v, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return time.Duration(v) * time.Second, true
+	}
+	if v, err := time.Parse(http.TimeFormat, v); err == nil {
+		return time.Until(v), true
+	}
+
+	return 0, false
+}
+
+// requestID returns the OpenStack request ID from the response headers.
+func requestID(headers http.Header) string {
+	for _, h := range []string{"X-Openstack-Request-Id", "X-Compute-Request-Id"} {
+		if v := headers.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
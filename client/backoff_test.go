@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+type bufferLogger struct {
+	lines []string
+}
+
+func (l *bufferLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestBackoffOptsRetryFunc(t *testing.T) {
+	logger := &bufferLogger{}
+	opts := BackoffOpts{
+		InitialDelay: time.Millisecond,
+		Jitter:       -1,
+		Logger:       logger,
+	}
+	f := opts.RetryFunc()
+
+	respErr := gophercloud.ErrUnexpectedResponseCode{
+		Method:         http.MethodDelete,
+		URL:            "http://example.com/v2.0/ports/1",
+		Actual:         http.StatusConflict,
+		ResponseHeader: http.Header{"X-Openstack-Request-Id": {"req-123"}},
+	}
+	th.AssertNoErr(t, f(context.Background(), respErr.Method, respErr.URL, nil, respErr, 1))
+	th.AssertEquals(t, 1, len(logger.lines))
+	th.AssertEquals(t, "Received 409 response code for DELETE http://example.com/v2.0/ports/1 (request ID: req-123), retry number 1 in 1ms", logger.lines[0])
+
+	// retries exhausted
+	th.AssertErr(t, f(context.Background(), respErr.Method, respErr.URL, nil, respErr, 6))
+
+	// 500 is retried only for idempotent requests
+	respErr.Actual = http.StatusInternalServerError
+	th.AssertNoErr(t, f(context.Background(), respErr.Method, respErr.URL, nil, respErr, 1))
+	respErr.Method = http.MethodPost
+	th.AssertErr(t, f(context.Background(), respErr.Method, respErr.URL, nil, respErr, 1))
+
+	// status codes missing in the table are not retried
+	respErr.Actual = http.StatusNotFound
+	th.AssertErr(t, f(context.Background(), respErr.Method, respErr.URL, nil, respErr, 1))
+
+	// other errors are returned as is
+	err := fmt.Errorf("unexpected EOF")
+	th.AssertEquals(t, err, f(context.Background(), http.MethodGet, "", nil, err, 1))
+}
+
+func TestBackoffOptsBudget(t *testing.T) {
+	opts := BackoffOpts{
+		InitialDelay:  time.Millisecond,
+		MaxTotalDelay: 5 * time.Millisecond,
+		Jitter:        -1,
+	}
+	f := opts.RetryBackoffFunc()
+
+	respErr := &gophercloud.ErrUnexpectedResponseCode{
+		Method:         http.MethodGet,
+		Actual:         http.StatusTooManyRequests,
+		ResponseHeader: http.Header{},
+	}
+	// 1ms + 2ms
+	th.AssertNoErr(t, f(context.Background(), respErr, nil, 1))
+	th.AssertNoErr(t, f(context.Background(), respErr, nil, 2))
+	// 1ms + 2ms + 4ms exceeds the budget
+	th.AssertErr(t, f(context.Background(), respErr, nil, 3))
+}
+
+func TestBackoffOptsRetryAfter(t *testing.T) {
+	opts := BackoffOpts{
+		MaxDelay: time.Millisecond,
+	}
+	f := opts.RetryBackoffFunc()
+
+	respErr := &gophercloud.ErrUnexpectedResponseCode{
+		Method:         http.MethodPost,
+		Actual:         http.StatusTooManyRequests,
+		ResponseHeader: http.Header{"Retry-After": {"3600"}},
+	}
+
+	// Retry-After is capped by MaxDelay
+	start := time.Now()
+	th.AssertNoErr(t, f(context.Background(), respErr, nil, 1))
+	if time.Since(start) > time.Minute {
+		t.Fatalf("Retry-After was not capped")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts.MaxDelay = time.Hour
+	th.AssertErr(t, opts.RetryBackoffFunc()(ctx, respErr, nil, 1))
+}
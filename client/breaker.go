@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is a state of a circuit breaker endpoint.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all the requests without sending them.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through in order to check
+	// whether the endpoint is healthy again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// Default values used by CircuitBreaker when the corresponding fields are not
+// set.
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitSuccessThreshold = 1
+	DefaultCircuitCooldown         = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without sending the request, when the circuit of
+// the endpoint is open.
+type ErrCircuitOpen struct {
+	Service string
+	Host    string
+	State   CircuitState
+	// RetryAt is the time, when a trial request will be let through.
+	RetryAt time.Time
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("OpenStack %s endpoint %s is unavailable, circuit breaker is %s until %s", e.Service, e.Host, e.State, e.RetryAt.Format(time.RFC3339))
+}
+
+// CircuitBreaker tracks the failures per service endpoint and fails fast the
+// requests to the endpoints, which are considered unhealthy.
+//
+// The circuit opens after FailureThreshold consecutive failures. After the
+// Cooldown a single trial request is let through in the half-open state.
+// The circuit closes after SuccessThreshold successful trial requests, and
+// opens again after a failed one.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures, which open the
+	// circuit. Defaults to DefaultCircuitFailureThreshold.
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successful trial
+	// requests, which close the circuit. Defaults to
+	// DefaultCircuitSuccessThreshold.
+	SuccessThreshold int
+	// Cooldown is the time the circuit stays open. Defaults to
+	// DefaultCircuitCooldown.
+	Cooldown time.Duration
+	// IsFailure reports whether the request result is a failure. By default
+	// connection errors, timeouts, including the expired request deadlines,
+	// and the 500, 502, 503 and 504 response codes are failures. Requests
+	// canceled by the caller are never counted.
+	IsFailure func(response *http.Response, err error) bool
+
+	mu       sync.Mutex
+	circuits map[circuitKey]*circuit
+}
+
+type circuitKey struct {
+	service string
+	host    string
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool
+}
+
+// State returns the circuit state of the service endpoint.
+func (cb *CircuitBreaker) State(service, host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.circuits[circuitKey{service, host}]; ok {
+		if c.state == CircuitOpen && !time.Now().Before(c.openedAt.Add(cb.cooldown())) {
+			return CircuitHalfOpen
+		}
+		return c.state
+	}
+	return CircuitClosed
+}
+
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.FailureThreshold > 0 {
+		return cb.FailureThreshold
+	}
+	return DefaultCircuitFailureThreshold
+}
+
+func (cb *CircuitBreaker) successThreshold() int {
+	if cb.SuccessThreshold > 0 {
+		return cb.SuccessThreshold
+	}
+	return DefaultCircuitSuccessThreshold
+}
+
+func (cb *CircuitBreaker) cooldown() time.Duration {
+	if cb.Cooldown > 0 {
+		return cb.Cooldown
+	}
+	return DefaultCircuitCooldown
+}
+
+func (cb *CircuitBreaker) isFailure(response *http.Response, err error) bool {
+	if cb.IsFailure != nil {
+		return cb.IsFailure(response, err)
+	}
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// allow reports whether the request may be sent and returns the previous and
+// the current circuit state.
+func (cb *CircuitBreaker) allow(key circuitKey, now time.Time) (CircuitState, CircuitState, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.circuits == nil {
+		cb.circuits = make(map[circuitKey]*circuit)
+	}
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[key] = c
+	}
+
+	from := c.state
+	retryAt := c.openedAt.Add(cb.cooldown())
+
+	switch c.state {
+	case CircuitOpen:
+		if now.Before(retryAt) {
+			break
+		}
+		c.state = CircuitHalfOpen
+		c.successes = 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.trial {
+			retryAt = now
+			break
+		}
+		c.trial = true
+		return from, c.state, nil
+	default:
+		return from, c.state, nil
+	}
+
+	return from, c.state, ErrCircuitOpen{
+		Service: key.service,
+		Host:    key.host,
+		State:   c.state,
+		RetryAt: retryAt,
+	}
+}
+
+// record updates the circuit with the request result and returns the previous
+// and the current circuit state.
+func (cb *CircuitBreaker) record(key circuitKey, failure bool, now time.Time) (CircuitState, CircuitState) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuits[key]
+	from := c.state
+
+	switch c.state {
+	case CircuitClosed:
+		if !failure {
+			c.failures = 0
+			break
+		}
+		c.failures++
+		if c.failures >= cb.failureThreshold() {
+			c.state = CircuitOpen
+			c.openedAt = now
+		}
+	case CircuitHalfOpen:
+		c.trial = false
+		if failure {
+			c.state = CircuitOpen
+			c.openedAt = now
+			break
+		}
+		c.successes++
+		if c.successes >= cb.successThreshold() {
+			c.state = CircuitClosed
+			c.failures = 0
+		}
+	}
+
+	return from, c.state
+}
+
+// release frees the half-open trial slot without recording a result.
+func (cb *CircuitBreaker) release(key circuitKey) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c := cb.circuits[key]; c.state == CircuitHalfOpen {
+		c.trial = false
+	}
+}
+
+// breaker returns a step, which fails fast the requests to the unhealthy
+// endpoints.
+func (rt *RoundTripper) breaker(cb *CircuitBreaker, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		service, _ := rt.resolveService(request.URL)
+		key := circuitKey{service: service, host: request.URL.Host}
+
+		from, to, err := cb.allow(key, time.Now())
+		rt.logCircuitState(key, from, to)
+		if err != nil {
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			return nil, err
+		}
+
+		response, err := next(request)
+
+		// The requests canceled by the caller and the rate limited ones say
+		// nothing about the endpoint. The deadline errors and the transport
+		// timeouts are failures, as a hanging endpoint must trip the breaker.
+		var rateLimited *rateLimitError
+		if errors.Is(request.Context().Err(), context.Canceled) || errors.As(err, &rateLimited) {
+			cb.release(key)
+			return response, err
+		}
+
+		from, to = cb.record(key, cb.isFailure(response, err), time.Now())
+		rt.logCircuitState(key, from, to)
+
+		return response, err
+	}
+}
+
+func (rt *RoundTripper) logCircuitState(key circuitKey, from, to CircuitState) {
+	if from != to && rt.Logger != nil {
+		rt.log().Printf("OpenStack %s endpoint %s circuit breaker changed from %s to %s", key.service, key.host, from, to)
+	}
+}
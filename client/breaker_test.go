@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	cb := &CircuitBreaker{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		Cooldown:         time.Minute,
+	}
+	key := circuitKey{service: "volume", host: "cinder.example.com"}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		_, _, err := cb.allow(key, now)
+		th.AssertNoErr(t, err)
+		cb.record(key, true, now)
+	}
+	th.AssertEquals(t, CircuitOpen, cb.State("volume", "cinder.example.com"))
+
+	_, _, err := cb.allow(key, now.Add(time.Second))
+	var errOpen ErrCircuitOpen
+	th.AssertEquals(t, true, errors.As(err, &errOpen))
+	th.AssertEquals(t, CircuitOpen, errOpen.State)
+	th.AssertEquals(t, now.Add(time.Minute), errOpen.RetryAt)
+
+	// a single trial request is let through after the cooldown
+	from, to, err := cb.allow(key, now.Add(time.Minute))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, CircuitOpen, from)
+	th.AssertEquals(t, CircuitHalfOpen, to)
+
+	_, _, err = cb.allow(key, now.Add(time.Minute))
+	th.AssertEquals(t, true, errors.As(err, &errOpen))
+	th.AssertEquals(t, CircuitHalfOpen, errOpen.State)
+
+	// a failed trial opens the circuit again
+	from, to = cb.record(key, true, now.Add(time.Minute))
+	th.AssertEquals(t, CircuitHalfOpen, from)
+	th.AssertEquals(t, CircuitOpen, to)
+
+	_, _, err = cb.allow(key, now.Add(2*time.Minute))
+	th.AssertNoErr(t, err)
+	from, to = cb.record(key, false, now.Add(2*time.Minute))
+	th.AssertEquals(t, CircuitHalfOpen, from)
+	th.AssertEquals(t, CircuitClosed, to)
+
+	// a success resets the consecutive failures
+	cb.record(key, true, now)
+	cb.record(key, false, now)
+	cb.record(key, true, now)
+	th.AssertEquals(t, CircuitClosed, cb.State("volume", "cinder.example.com"))
+}
+
+func TestRoundTripperCircuitBreaker(t *testing.T) {
+	logger := &bufferLogger{}
+	transport := &flakyTransport{failures: 100}
+	rt := &RoundTripper{
+		Rt:     transport,
+		Logger: logger,
+		CircuitBreaker: &CircuitBreaker{
+			FailureThreshold: 2,
+			Cooldown:         time.Hour,
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodGet, "http://example.com:8776/v3/volumes", nil)
+		_, err := rt.RoundTrip(request)
+		th.AssertErr(t, err)
+	}
+	th.AssertEquals(t, 2, transport.calls)
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:8776/v3/volumes", nil)
+	_, err := rt.RoundTrip(request)
+	var errOpen ErrCircuitOpen
+	th.AssertEquals(t, true, errors.As(err, &errOpen))
+	th.AssertEquals(t, "volume", errOpen.Service)
+	th.AssertEquals(t, "example.com:8776", errOpen.Host)
+	th.AssertEquals(t, 2, transport.calls)
+
+	// other endpoints are not affected
+	rt.Rt = staticTransport{status: http.StatusOK}
+	request, _ = http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	th.AssertEquals(t, true, strings.Contains(fmt.Sprint(logger.lines), "OpenStack volume endpoint example.com:8776 circuit breaker changed from closed to open"))
+}
+
+// timeoutError is a transport timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRoundTripperCircuitBreakerTimeouts(t *testing.T) {
+	var calls int
+	rt := &RoundTripper{
+		// a hanging endpoint
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			calls++
+			<-request.Context().Done()
+			return nil, request.Context().Err()
+		}),
+		CircuitBreaker: &CircuitBreaker{
+			FailureThreshold: 2,
+			Cooldown:         time.Hour,
+		},
+	}
+
+	// the requests canceled by the caller are not counted
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:8776/v3/volumes", nil)
+		_, err := rt.RoundTrip(request)
+		th.AssertEquals(t, true, errors.Is(err, context.Canceled))
+	}
+	th.AssertEquals(t, CircuitClosed, rt.CircuitBreaker.State("volume", "example.com:8776"))
+
+	// the expired deadlines are
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:8776/v3/volumes", nil)
+		_, err := rt.RoundTrip(request)
+		cancel()
+		th.AssertEquals(t, true, errors.Is(err, context.DeadlineExceeded))
+	}
+	th.AssertEquals(t, CircuitOpen, rt.CircuitBreaker.State("volume", "example.com:8776"))
+	th.AssertEquals(t, 4, calls)
+
+	// and so are the transport timeouts
+	rt.Rt = roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		return nil, &url.Error{Op: "Get", URL: request.URL.String(), Err: timeoutError{}}
+	})
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+		_, err := rt.RoundTrip(request)
+		var netErr net.Error
+		th.AssertEquals(t, true, errors.As(err, &netErr) && netErr.Timeout())
+	}
+	th.AssertEquals(t, CircuitOpen, rt.CircuitBreaker.State("compute", "example.com:8774"))
+}
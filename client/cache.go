@@ -0,0 +1,327 @@
+package client
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default values used by ResponseCache when the corresponding fields are not
+// set.
+const (
+	DefaultCacheMaxEntries  = 1000
+	DefaultCacheMaxBodySize = 1 << 20
+)
+
+// List of service types, which responses are never cached.
+var defaultCacheExcludedServices = map[string]struct{}{
+	"key-manager": {},
+}
+
+// DefaultCacheExcludedPaths is the list of request paths, which responses
+// contain secrets and are never cached.
+var DefaultCacheExcludedPaths = []*regexp.Regexp{
+	regexp.MustCompile(`/auth/tokens`),
+	regexp.MustCompile(`/v2\.0/tokens`),
+	regexp.MustCompile(`/credentials`),
+	regexp.MustCompile(`/OS-EC2`),
+	regexp.MustCompile(`/application_credentials`),
+	regexp.MustCompile(`/os-server-password`),
+	regexp.MustCompile(`/certificates`),
+	regexp.MustCompile(`/secrets`),
+}
+
+// ResponseCache is an in-memory LRU cache of the GET responses, which carry
+// an ETag or a Last-Modified header. The cached responses are always
+// revalidated with the If-None-Match and If-Modified-Since headers, and
+// served from the cache only when the server responds with 304 Not Modified.
+//
+// The entries are scoped per authentication token, which in turn is scoped to
+// a project, so the responses are never shared between users or projects.
+// They are keyed by the request headers as well, except the ones, which differ
+// between the requests, e.g. the trace context or the request ID.
+type ResponseCache struct {
+	// MaxEntries is the maximum number of the cached responses.
+	// Defaults to DefaultCacheMaxEntries.
+	MaxEntries int
+	// MaxBodySize is the maximum size of a cached response body in bytes.
+	// Defaults to DefaultCacheMaxBodySize.
+	MaxBodySize int64
+	// ExcludedPaths are the request paths, which are never cached.
+	// Defaults to DefaultCacheExcludedPaths.
+	ExcludedPaths []*regexp.Regexp
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[cacheKey]*list.Element
+}
+
+type cacheKey struct {
+	scope string
+	url   string
+	vary  string
+}
+
+type cacheEntry struct {
+	key          cacheKey
+	status       int
+	header       http.Header
+	body         []byte
+	etag         string
+	lastModified string
+}
+
+// Len returns the number of the cached responses.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
+
+func (c *ResponseCache) get(key cacheKey) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*cacheEntry), true
+	}
+	return nil, false
+}
+
+func (c *ResponseCache) add(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		c.lru = list.New()
+		c.items = make(map[cacheKey]*list.Element)
+	}
+
+	if e, ok := c.items[entry.key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.items[entry.key] = c.lru.PushFront(entry)
+
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	for c.lru.Len() > maxEntries {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *ResponseCache) remove(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.lru.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+func (c *ResponseCache) maxBodySize() int64 {
+	if c.MaxBodySize > 0 {
+		return c.MaxBodySize
+	}
+	return DefaultCacheMaxBodySize
+}
+
+// excluded reports whether the response to the request may carry secrets.
+func (c *ResponseCache) excluded(request *http.Request, service string) bool {
+	if _, ok := defaultCacheExcludedServices[service]; ok {
+		return true
+	}
+
+	paths := c.ExcludedPaths
+	if paths == nil {
+		paths = DefaultCacheExcludedPaths
+	}
+	for _, p := range paths {
+		if p.MatchString(request.URL.Path) {
+			return true
+		}
+	}
+
+	return strings.Contains(request.Header.Get("Cache-Control"), "no-store")
+}
+
+// cacheVolatileHeaders are the request headers, which differ between the
+// requests, but don't change the response. They are not a part of the cache
+// key.
+var cacheVolatileHeaders = map[string]struct{}{
+	"X-Auth-Token":           {},
+	"Traceparent":            {},
+	"Tracestate":             {},
+	"Baggage":                {},
+	"X-Openstack-Request-Id": {},
+	"X-Request-Id":           {},
+	"Idempotency-Key":        {},
+	"X-Idempotency-Key":      {},
+}
+
+// cacheKeyFor returns the cache key of the request. The token and the other
+// headers are hashed in order to not keep them in memory.
+func cacheKeyFor(request *http.Request) cacheKey {
+	key := cacheKey{url: request.URL.String()}
+
+	if token := request.Header.Get("X-Auth-Token"); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		key.scope = hex.EncodeToString(sum[:])
+	}
+
+	// any header may change the representation, e.g. the microversion or
+	// the media type
+	var vary []string
+	for k, v := range request.Header {
+		if _, ok := cacheVolatileHeaders[http.CanonicalHeaderKey(k)]; ok {
+			continue
+		}
+		vary = append(vary, http.CanonicalHeaderKey(k)+": "+strings.Join(v, ","))
+	}
+	if len(vary) > 0 {
+		sort.Strings(vary)
+		sum := sha256.Sum256([]byte(strings.Join(vary, "\n")))
+		key.vary = hex.EncodeToString(sum[:])
+	}
+
+	return key
+}
+
+// cacheResponses returns a step, which revalidates the cached GET responses
+// and serves them, when they were not modified.
+func (rt *RoundTripper) cacheResponses(c *ResponseCache, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		if request.Method != http.MethodGet {
+			return next(request)
+		}
+
+		// the caller is revalidating on its own
+		if request.Header.Get("If-None-Match") != "" || request.Header.Get("If-Modified-Since") != "" {
+			return next(request)
+		}
+
+		service, _ := rt.resolveService(request.URL)
+		if c.excluded(request, service) {
+			return next(request)
+		}
+
+		key := cacheKeyFor(request)
+		entry, cached := c.get(key)
+		revalidation := request
+		if cached {
+			// the original request must not be modified
+			revalidation = request.Clone(request.Context())
+			if entry.etag != "" {
+				revalidation.Header.Set("If-None-Match", entry.etag)
+			}
+			if entry.lastModified != "" {
+				revalidation.Header.Set("If-Modified-Since", entry.lastModified)
+			}
+		}
+
+		response, err := next(revalidation)
+
+		if err != nil || response == nil {
+			return response, err
+		}
+
+		if cached && response.StatusCode == http.StatusNotModified {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+			return entry.response(request, response.Header), nil
+		}
+
+		if response.StatusCode != http.StatusOK {
+			if cached {
+				c.remove(key)
+			}
+			return response, nil
+		}
+
+		etag := response.Header.Get("ETag")
+		lastModified := response.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" ||
+			strings.Contains(response.Header.Get("Cache-Control"), "no-store") ||
+			response.Header.Get("X-Subject-Token") != "" ||
+			response.ContentLength > c.maxBodySize() {
+			if cached {
+				c.remove(key)
+			}
+			return response, nil
+		}
+
+		body, err := io.ReadAll(io.LimitReader(response.Body, c.maxBodySize()+1))
+		if err != nil {
+			response.Body.Close()
+			return nil, err
+		}
+		if int64(len(body)) > c.maxBodySize() {
+			if cached {
+				c.remove(key)
+			}
+			// too large, return the already read part together with the rest
+			response.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), response.Body), response.Body}
+			return response, nil
+		}
+		response.Body.Close()
+		response.Body = io.NopCloser(bytes.NewReader(body))
+
+		c.add(&cacheEntry{
+			key:          key,
+			status:       response.StatusCode,
+			header:       response.Header.Clone(),
+			body:         body,
+			etag:         etag,
+			lastModified: lastModified,
+		})
+
+		return response, nil
+	}
+}
+
+// response returns the cached response updated with the headers of the 304
+// Not Modified response.
+func (e *cacheEntry) response(request *http.Request, updated http.Header) *http.Response {
+	header := e.header.Clone()
+	for k, v := range updated {
+		// the 304 response has no body
+		if k == "Content-Length" || k == "Content-Type" {
+			continue
+		}
+		header[k] = v
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestRoundTripperCache(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"server": {"id": "1"}}`))
+	}))
+	defer server.Close()
+
+	// the caller's request must not be modified while it is sent
+	var original *http.Request
+	cache := &ResponseCache{MaxEntries: 2}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			th.AssertEquals(t, "", original.Header.Get("If-None-Match"))
+			return http.DefaultTransport.RoundTrip(request)
+		}),
+		Cache: cache,
+	}
+
+	get := func(path, token string) (*http.Response, string) {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		request.Header.Set("X-Auth-Token", token)
+		original = request
+		response, err := rt.RoundTrip(request)
+		th.AssertNoErr(t, err)
+		body, err := io.ReadAll(response.Body)
+		th.AssertNoErr(t, err)
+		response.Body.Close()
+		th.AssertEquals(t, "", request.Header.Get("If-None-Match"))
+		return response, string(body)
+	}
+
+	response, body := get("/servers/1", "token-a")
+	th.AssertEquals(t, http.StatusOK, response.StatusCode)
+	th.AssertEquals(t, `{"server": {"id": "1"}}`, body)
+	th.AssertEquals(t, 0, notModified)
+
+	// revalidated and served from the cache
+	response, body = get("/servers/1", "token-a")
+	th.AssertEquals(t, http.StatusOK, response.StatusCode)
+	th.AssertEquals(t, "application/json", response.Header.Get("Content-Type"))
+	th.AssertEquals(t, `{"server": {"id": "1"}}`, body)
+	th.AssertEquals(t, 1, notModified)
+
+	// another token has its own scope
+	_, body = get("/servers/1", "token-b")
+	th.AssertEquals(t, `{"server": {"id": "1"}}`, body)
+	th.AssertEquals(t, 1, notModified)
+	th.AssertEquals(t, 2, cache.Len())
+
+	// the least recently used entry is evicted
+	get("/servers/2", "token-a")
+	th.AssertEquals(t, 2, cache.Len())
+	get("/servers/1", "token-a")
+	th.AssertEquals(t, 1, notModified)
+
+	// sensitive endpoints are never cached
+	get("/v3/credentials", "token-a")
+	get("/v3/credentials", "token-a")
+	th.AssertEquals(t, 1, notModified)
+	th.AssertEquals(t, 7, requests)
+}
+
+func TestCacheKeyHeaders(t *testing.T) {
+	request := func(headers map[string]string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers/1", nil)
+		r.Header.Set("X-Auth-Token", "token")
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	key := cacheKeyFor(request(map[string]string{"Accept": "application/json"}))
+
+	// the volatile headers don't change the key
+	th.AssertEquals(t, key, cacheKeyFor(request(map[string]string{
+		"Accept":                 "application/json",
+		"Traceparent":            "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"X-Openstack-Request-Id": "req-1",
+	})))
+
+	// any other header does
+	for _, headers := range []map[string]string{
+		{"Accept": "application/xml"},
+		{"Accept": "application/json", "Accept-Language": "de"},
+		{"Accept": "application/json", "X-Service-Token": "service-token"},
+		{"Accept": "application/json", "Openstack-Api-Version": "compute 2.79"},
+	} {
+		if cacheKeyFor(request(headers)) == key {
+			t.Errorf("expected another cache key for %v", headers)
+		}
+	}
+}
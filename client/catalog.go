@@ -0,0 +1,287 @@
+package client
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// serviceEndpoint is a single catalog endpoint URL of a service type.
+type serviceEndpoint struct {
+	host        string
+	path        string
+	serviceType string
+}
+
+// List of default ports of the OpenStack services, used to guess the service
+// type when the catalog is unknown.
+var defaultServicePorts = map[string]string{
+	"5000":  "identity",
+	"35357": "identity",
+	"8774":  "compute",
+	"8775":  "compute",
+	"9696":  "network",
+	"9292":  "image",
+	"8776":  "volume",
+	"8080":  "object-store",
+	"9876":  "load-balancer",
+	"9001":  "dns",
+	"6385":  "baremetal",
+	"5050":  "baremetal-introspection",
+	"8041":  "metric",
+	"8004":  "orchestration",
+	"9311":  "key-manager",
+	"8778":  "placement",
+	"8786":  "sharev2",
+	"9511":  "container-infra",
+	"8779":  "database",
+	"8989":  "workflowv2",
+	"9517":  "container",
+	"8888":  "messaging",
+}
+
+// List of path prefixes used by the OpenStack services deployed behind a
+// single web server, e.g. in DevStack.
+var defaultServicePaths = map[string]string{
+	"identity":      "identity",
+	"compute":       "compute",
+	"networking":    "network",
+	"image":         "image",
+	"volume":        "volume",
+	"object-store":  "object-store",
+	"swift":         "object-store",
+	"load-balancer": "load-balancer",
+	"dns":           "dns",
+	"baremetal":     "baremetal",
+	"metric":        "metric",
+	"heat-api":      "orchestration",
+	"key-manager":   "key-manager",
+	"placement":     "placement",
+	"share":         "sharev2",
+}
+
+// serviceCatalog maps the request URLs to the service types.
+type serviceCatalog struct {
+	// A pointer to a list of catalog endpoints sorted by the path length
+	endpoints *[]serviceEndpoint
+}
+
+// SetServiceEndpoints sets the mapping of catalog endpoint URLs to service
+// types, which is used to label requests with a service type. The mapping is
+// also learned automatically from the Keystone token responses.
+func (rt *RoundTripper) SetServiceEndpoints(endpoints map[string]string) {
+	rt.catalog.set(endpoints)
+}
+
+// resolveService returns the service type of the request URL and the path
+// relative to the service endpoint.
+func (rt *RoundTripper) resolveService(u *url.URL) (string, string) {
+	return rt.catalog.resolve(u)
+}
+
+// learnServiceEndpoints extracts the service endpoints from a Keystone v2 or
+// v3 token response body.
+func (rt *RoundTripper) learnServiceEndpoints(body []byte) {
+	rt.catalog.learn(body)
+}
+
+func (c *serviceCatalog) set(endpoints map[string]string) {
+	newEndpoints := make([]serviceEndpoint, 0, len(endpoints))
+	for rawURL, serviceType := range endpoints {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		newEndpoints = append(newEndpoints, serviceEndpoint{
+			host:        strings.ToLower(u.Host),
+			path:        strings.TrimRight(u.Path, "/"),
+			serviceType: serviceType,
+		})
+	}
+
+	// the longest path prefix wins
+	sort.Slice(newEndpoints, func(i, j int) bool {
+		return len(newEndpoints[i].path) > len(newEndpoints[j].path)
+	})
+
+	// this is concurrency safe
+	c.endpoints = &newEndpoints
+}
+
+func (c *serviceCatalog) resolve(u *url.URL) (string, string) {
+	host := strings.ToLower(u.Host)
+	path := u.Path
+
+	// this is concurrency safe
+	if v := c.endpoints; v != nil {
+		for _, e := range *v {
+			if e.host != host {
+				continue
+			}
+			if path == e.path || strings.HasPrefix(path, e.path+"/") {
+				return e.serviceType, defaultIfEmpty(strings.TrimPrefix(path, e.path), "/")
+			}
+		}
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if v, ok := defaultServicePaths[segments[0]]; ok {
+		if len(segments) > 1 {
+			return v, "/" + segments[1]
+		}
+		return v, "/"
+	}
+
+	if _, port, err := net.SplitHostPort(u.Host); err == nil {
+		if v, ok := defaultServicePorts[port]; ok {
+			return v, path
+		}
+	}
+
+	return "unknown", path
+}
+
+// defaultIfEmpty is a helper function to make it cleaner to set default value
+// for strings.
+func defaultIfEmpty(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// isTokenRequest reports whether the request creates a Keystone token.
+func isTokenRequest(request *http.Request) bool {
+	return request.Method == http.MethodPost && (strings.HasSuffix(request.URL.Path, "/auth/tokens") || strings.HasSuffix(request.URL.Path, "/v2.0/tokens"))
+}
+
+// learnEndpoints returns a step, which learns the service endpoints from the
+// Keystone token responses.
+func (rt *RoundTripper) learnEndpoints(next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		response, err := next(request)
+		if response != nil {
+			if e := rt.catalog.observe(request, response); e != nil {
+				return nil, e
+			}
+		}
+
+		return response, err
+	}
+}
+
+// observe learns the service endpoints from a successful Keystone token
+// response.
+func (c *serviceCatalog) observe(request *http.Request, response *http.Response) error {
+	if !isTokenRequest(request) || response.StatusCode >= 300 || !strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+
+	body, err := readResponseBody(response)
+	if err != nil {
+		return err
+	}
+	c.learn(body)
+
+	return nil
+}
+
+func (c *serviceCatalog) learn(body []byte) {
+	var catalog struct {
+		Token struct {
+			Catalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					URL string `json:"url"`
+				} `json:"endpoints"`
+			} `json:"catalog"`
+		} `json:"token"`
+		Access struct {
+			ServiceCatalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					PublicURL   string `json:"publicURL"`
+					InternalURL string `json:"internalURL"`
+					AdminURL    string `json:"adminURL"`
+				} `json:"endpoints"`
+			} `json:"serviceCatalog"`
+		} `json:"access"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return
+	}
+
+	endpoints := make(map[string]string)
+	for _, s := range catalog.Token.Catalog {
+		for _, e := range s.Endpoints {
+			endpoints[e.URL] = s.Type
+		}
+	}
+	for _, s := range catalog.Access.ServiceCatalog {
+		for _, e := range s.Endpoints {
+			for _, u := range []string{e.PublicURL, e.InternalURL, e.AdminURL} {
+				if u != "" {
+					endpoints[u] = s.Type
+				}
+			}
+		}
+	}
+
+	if len(endpoints) > 0 {
+		c.set(endpoints)
+	}
+}
+
+var (
+	uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+	hexRegexp  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	numRegexp  = regexp.MustCompile(`^[0-9]+$`)
+
+	versionRegexp = regexp.MustCompile(`^v[0-9.]+$`)
+)
+
+// pathTemplate collapses the IDs and the object storage names of a request
+// path into placeholders in order to keep the cardinality low.
+func pathTemplate(serviceType, path string) string {
+	if serviceType == "object-store" {
+		return objectStoragePathTemplate(path)
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if uuidRegexp.MatchString(s) || hexRegexp.MatchString(s) || numRegexp.MatchString(s) || strings.HasPrefix(s, "req-") {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// objectStoragePathTemplate replaces the account, container and object names,
+// which may contain slashes, with placeholders.
+func objectStoragePathTemplate(path string) string {
+	trimmed := strings.TrimPrefix(path, "/")
+	if trimmed == "" || trimmed == "info" {
+		return path
+	}
+
+	// the path is either absolute, e.g. /v1/AUTH_account/container/object
+	// or relative to the catalog endpoint, e.g. /container/object
+	names := []string{"{container}", "{object}"}
+	if versionRegexp.MatchString(strings.SplitN(trimmed, "/", 2)[0]) {
+		names = []string{"", "{account}", "{container}", "{object}"}
+	}
+
+	segments := strings.SplitN(trimmed, "/", len(names))
+	for i := range segments {
+		if names[i] != "" && segments[i] != "" {
+			segments[i] = names[i]
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -3,14 +3,12 @@ package client
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -46,13 +44,56 @@ type RoundTripper struct {
 	headers *http.Header
 	// A pointer to a map of headers to be masked in logger
 	maskHeaders *map[string]struct{}
+	// A pointer to a set of JSON paths to be masked in logger
+	redactor *Redactor
 	// A custom function to format and mask JSON requests and responses
 	FormatJSON func([]byte) (string, error)
 	// How many times HTTP connection should be retried until giving up
 	MaxRetries int
+	// RetryPolicy defines the delay between the connection retries and
+	// whether a request may be retried. Defaults to an ExponentialBackoff,
+	// which retries only idempotent requests.
+	RetryPolicy RetryPolicy
 	// If Logger is not nil, then RoundTrip method will debug the JSON
 	// requests and responses
 	Logger Logger
+	// If LogCurl is true, then RoundTrip method will log the requests as
+	// equivalent curl commands instead of the multi-line debug output
+	LogCurl bool
+	// LogMaxBodySize is the maximum number of the logged body bytes. The
+	// rest of the body is not read for logging. Defaults to
+	// DefaultLogMaxBodySize.
+	LogMaxBodySize int64
+	// If StructuredLogger is not nil, then RoundTrip method will emit a
+	// single structured debug record per request and response exchange
+	StructuredLogger *slog.Logger
+	// If Metrics is not nil, then RoundTrip method will report each request
+	// with its service type, path template, status code and duration
+	Metrics MetricsObserver
+	// If Tracer is not nil, then RoundTrip method will wrap each request into
+	// a span and propagate it with the W3C traceparent header
+	Tracer Tracer
+	// If RateLimiter is not nil, then RoundTrip method will delay the
+	// requests exceeding the per host or per service type budget
+	RateLimiter *RateLimiter
+	// If CircuitBreaker is not nil, then RoundTrip method will fail fast the
+	// requests to the endpoints, which keep failing
+	CircuitBreaker *CircuitBreaker
+	// If HAR is not nil, then RoundTrip method will record each request and
+	// response exchange in the HTTP Archive format
+	HAR *HARRecorder
+	// If Cache is not nil, then RoundTrip method will revalidate the cached
+	// GET responses and serve them, when they were not modified
+	Cache *ResponseCache
+	// If Policy is not nil, then RoundTrip method will fail the requests
+	// denied by the policy without sending them
+	Policy *Policy
+	// If Audit is not nil, then RoundTrip method will append a record per
+	// mutating request into the audit log
+	Audit *AuditLog
+	// A list of catalog endpoints used to determine the service type of a
+	// request
+	catalog serviceCatalog
 }
 
 // List of headers that contain sensitive data.
@@ -111,16 +152,20 @@ func (rt *RoundTripper) SetHeaders(headers http.Header) {
 	rt.headers = &newHeaders
 }
 
-func (rt *RoundTripper) hideSensitiveHeadersData(headers http.Header) []string {
-	result := make([]string, len(headers))
-	headerIdx := 0
-
+func (rt *RoundTripper) sensitiveHeaders() map[string]struct{} {
 	// this is concurrency safe
 	v := rt.maskHeaders
 	if v == nil {
 		v = &defaultSensitiveHeaders
 	}
-	maskHeaders := *v
+	return *v
+}
+
+func (rt *RoundTripper) hideSensitiveHeadersData(headers http.Header) []string {
+	result := make([]string, len(headers))
+	headerIdx := 0
+
+	maskHeaders := rt.sensitiveHeaders()
 
 	for header, data := range headers {
 		v := strings.ToLower(header)
@@ -146,6 +191,48 @@ func (rt *RoundTripper) formatHeaders(headers http.Header, separator string) str
 
 // RoundTrip performs a round-trip HTTP request and logs relevant information about it.
 func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := rt.captureRequestID(rt.roundTrip)
+
+	// this is concurrency safe
+	if rt.RateLimiter != nil || rt.CircuitBreaker != nil || rt.Cache != nil || rt.Metrics != nil || rt.Tracer != nil || rt.Policy != nil || rt.Audit != nil {
+		next = rt.learnEndpoints(next)
+	}
+	if c := rt.Cache; c != nil {
+		next = rt.cacheResponses(c, next)
+	}
+	if l := rt.RateLimiter; l != nil {
+		next = rt.rateLimit(l, next)
+	}
+	if cb := rt.CircuitBreaker; cb != nil {
+		next = rt.breaker(cb, next)
+	}
+	if p := rt.Policy; p != nil {
+		next = rt.enforcePolicy(p, next)
+	}
+	if a := rt.Audit; a != nil {
+		next = rt.audit(a, next)
+	}
+	if l := rt.StructuredLogger; l != nil {
+		next = rt.logExchange(l, next)
+	}
+	if m := rt.Metrics; m != nil {
+		next = rt.instrument(m, next)
+	}
+	if h := rt.HAR; h != nil {
+		next = rt.recordHAR(h, next)
+	}
+	if t := rt.Tracer; t != nil {
+		next = rt.trace(t, next)
+	}
+
+	return next(request)
+}
+
+// roundTripFunc is a single step of the RoundTrip method.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// roundTrip performs a round-trip HTTP request with retries and debug logging.
+func (rt *RoundTripper) roundTrip(request *http.Request) (*http.Response, error) {
 	defer func() {
 		if request.Body != nil {
 			request.Body.Close()
@@ -166,23 +253,40 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 
 	var err error
 
-	if rt.Logger != nil {
+	if rt.Logger != nil && rt.LogCurl {
+		cmd, err := rt.curlCommand(request)
+		if err != nil {
+			return nil, err
+		}
+		rt.log().Printf("OpenStack Request: %s", cmd)
+	} else if rt.Logger != nil {
 		rt.log().Printf("OpenStack Request URL: %s %s", request.Method, request.URL)
 		rt.log().Printf("OpenStack Request Headers:\n%s", rt.formatHeaders(request.Header, "\n"))
 
 		if request.Body != nil {
-			request.Body, err = rt.logRequest(request.Body, request.Header.Get("Content-Type"))
+			request.Body, err = rt.logRequest(request.Body, request.Header.Get("Content-Type"), request.ContentLength)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
 
+	// The logger may have consumed the original body, make sure the request
+	// can be retried with an in-memory copy. The request of the caller must
+	// not be modified, so the copy is set on a clone.
+	if request.GetBody == nil {
+		if v, ok := request.Body.(*bufferedBody); ok {
+			request = request.Clone(request.Context())
+			request.GetBody = v.copy
+		}
+	}
+
 	// this is concurrency safe
 	ort := rt.Rt
 	if ort == nil {
 		return nil, fmt.Errorf("Rt RoundTripper is nil, aborting")
 	}
+	start := time.Now()
 	response, err := ort.RoundTrip(request)
 
 	// If the first request didn't return a response, retry up to `max_retries`.
@@ -192,13 +296,32 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 			if rt.Logger != nil {
 				rt.log().Printf("OpenStack connection error, retries exhausted. Aborting")
 			}
-			err = fmt.Errorf("OpenStack connection error, retries exhausted. Aborting. Last error was: %s", err)
+			err = fmt.Errorf("OpenStack connection error, retries exhausted. Aborting. Last error was: %w", err)
+			return nil, err
+		}
+
+		delay, ok := rt.retryPolicy().Backoff(request, retry, time.Since(start), err)
+		if !ok {
+			if rt.Logger != nil {
+				rt.log().Printf("OpenStack connection error, %s request is not retried: %s", request.Method, err)
+			}
+			return nil, err
+		}
+
+		if e := rewindBody(request); e != nil {
+			if rt.Logger != nil {
+				rt.log().Printf("OpenStack connection error, request can't be retried: %s", e)
+			}
 			return nil, err
 		}
 
 		if rt.Logger != nil {
-			rt.log().Printf("OpenStack connection error, retry number %d: %s", retry, err)
+			rt.log().Printf("OpenStack connection error, retry number %d in %s: %s", retry, delay, err)
+		}
+		if e := sleepContext(request.Context(), delay); e != nil {
+			return nil, fmt.Errorf("OpenStack connection retry aborted: %w. Last error was: %w", e, err)
 		}
+
 		response, err = ort.RoundTrip(request)
 		retry += 1
 	}
@@ -207,7 +330,7 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		rt.log().Printf("OpenStack Response Code: %d", response.StatusCode)
 		rt.log().Printf("OpenStack Response Headers:\n%s", rt.formatHeaders(response.Header, "\n"))
 
-		response.Body, err = rt.logResponse(response.Body, response.Header.Get("Content-Type"))
+		response.Body, err = rt.logResponse(response.Body, response.Header.Get("Content-Type"), response.ContentLength)
 	}
 
 	return response, err
@@ -215,66 +338,165 @@ func (rt *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 
 // logRequest will log the HTTP Request details.
 // If the body is JSON, it will attempt to be pretty-formatted.
-func (rt *RoundTripper) logRequest(original io.ReadCloser, contentType string) (io.ReadCloser, error) {
-	// Handle request contentType
-	if strings.HasPrefix(contentType, "application/json") || (strings.HasPrefix(contentType, "application/") && strings.HasSuffix(contentType, "-json-patch")) {
-		var bs bytes.Buffer
-		defer original.Close()
+func (rt *RoundTripper) logRequest(original io.ReadCloser, contentType string, contentLength int64) (io.ReadCloser, error) {
+	text, _, body, err := rt.peekRequestBody(original, contentType, contentLength, rt.logJSON)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		rt.log().Printf("OpenStack Request Body: %s", text)
+	}
+	return body, nil
+}
 
-		_, err := io.Copy(&bs, original)
-		if err != nil {
-			return nil, err
-		}
+// logResponse will log the HTTP Response details.
+// If the body is JSON, it will attempt to be pretty-formatted.
+func (rt *RoundTripper) logResponse(original io.ReadCloser, contentType string, contentLength int64) (io.ReadCloser, error) {
+	text, _, body, err := rt.peekResponseBody(original, contentType, contentLength, rt.logJSON)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		rt.log().Printf("OpenStack Response Body: %s", text)
+	}
+	return body, nil
+}
 
-		debugInfo, err := rt.formatJSON()(bs.Bytes())
-		if err != nil {
-			rt.log().Printf("%s", err)
-		}
-		rt.log().Printf("OpenStack Request Body: %s", debugInfo)
+// logJSON formats the JSON body for the debug log.
+func (rt *RoundTripper) logJSON(body []byte) string {
+	debugInfo, err := rt.formatJSON()(body)
+	if err != nil {
+		rt.log().Printf("%s", err)
+	}
+	return debugInfo
+}
+
+// peekRequestBody returns the loggable text and the size of the request
+// body, which is -1 when unknown, and the body to be sent instead of the
+// original one.
+func (rt *RoundTripper) peekRequestBody(original io.ReadCloser, contentType string, contentLength int64, formatJSON func([]byte) string) (string, int64, io.ReadCloser, error) {
+	// the zero length of a request with a body means unknown
+	if contentLength == 0 {
+		contentLength = -1
+	}
 
-		return ioutil.NopCloser(strings.NewReader(bs.String())), nil
+	text, body, complete, err := rt.peekBody(original, contentType, contentLength, formatJSON)
+	if err != nil {
+		return "", 0, nil, err
 	}
 
-	rt.log().Printf("Not logging because OpenStack request body isn't JSON")
-	return original, nil
+	// keep the fully read body in memory, so the request can be retried
+	if complete {
+		defer original.Close()
+		return text, int64(len(body)), newBufferedBody(body), nil
+	}
+	return text, contentLength, peekedBody(body, original), nil
 }
 
-// logResponse will log the HTTP Response details.
-// If the body is JSON, it will attempt to be pretty-formatted.
-func (rt *RoundTripper) logResponse(original io.ReadCloser, contentType string) (io.ReadCloser, error) {
-	if strings.HasPrefix(contentType, "application/json") {
-		var bs bytes.Buffer
+// peekResponseBody returns the loggable text and the size of the response
+// body, which is -1 when unknown, and the body to be returned instead of the
+// original one.
+func (rt *RoundTripper) peekResponseBody(original io.ReadCloser, contentType string, contentLength int64, formatJSON func([]byte) string) (string, int64, io.ReadCloser, error) {
+	// net/http sets http.NoBody for the empty responses, the zero length
+	// of other bodies, e.g. of a custom transport, means unknown
+	if contentLength == 0 && original != nil && original != http.NoBody {
+		contentLength = -1
+	}
+
+	text, body, complete, err := rt.peekBody(original, contentType, contentLength, formatJSON)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	if complete {
 		defer original.Close()
+		return text, int64(len(body)), io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return text, contentLength, peekedBody(body, original), nil
+}
 
-		_, err := io.Copy(&bs, original)
-		if err != nil {
-			return nil, err
-		}
+// peekBody reads up to the maximum log body size of the request or response
+// body without reading the rest of it. It returns the loggable text, the read
+// part and whether it is the whole body. The binary bodies are only
+// summarized and not read.
+func (rt *RoundTripper) peekBody(original io.ReadCloser, contentType string, contentLength int64, formatJSON func([]byte) string) (string, []byte, bool, error) {
+	if contentLength == 0 || original == nil || original == http.NoBody {
+		return "", nil, false, nil
+	}
 
-		debugInfo, err := rt.formatJSON()(bs.Bytes())
-		if err != nil {
-			rt.log().Printf("%s", err)
-		}
-		if debugInfo != "" {
-			rt.log().Printf("OpenStack Response Body: %s", debugInfo)
+	isJSON := isJSONRequest(contentType) || isJSONContentType(contentType)
+	if !isJSON && !isTextContentType(contentType) {
+		size := "unknown size"
+		if contentLength >= 0 {
+			size = fmt.Sprintf("%d bytes", contentLength)
 		}
+		return fmt.Sprintf("<binary %s body of %s>", defaultIfEmpty(contentType, "unknown content type"), size), nil, false, nil
+	}
 
-		return ioutil.NopCloser(strings.NewReader(bs.String())), nil
+	limit := rt.logMaxBodySize()
+
+	// read one byte more to find out whether the body is truncated
+	body, err := io.ReadAll(io.LimitReader(original, limit+1))
+	if err != nil {
+		original.Close()
+		return "", nil, false, err
+	}
+	complete := int64(len(body)) <= limit
+
+	switch {
+	case isJSON && complete:
+		return formatJSON(body), body, complete, nil
+	case isJSON:
+		// a partial JSON document cannot be masked
+		return fmt.Sprintf("<JSON body larger than %d bytes is not logged>", limit), body, complete, nil
+	}
+
+	text := body
+	if !complete {
+		text = body[:limit]
+	}
+	debugInfo := string(text)
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		debugInfo = maskFormBody(debugInfo)
+	}
+	if !complete {
+		debugInfo += "... <truncated>"
 	}
 
-	rt.log().Printf("Not logging because OpenStack response body isn't JSON")
-	return original, nil
+	return debugInfo, body, complete, nil
+}
+
+func (rt *RoundTripper) logMaxBodySize() int64 {
+	if rt.LogMaxBodySize > 0 {
+		return rt.LogMaxBodySize
+	}
+	return DefaultLogMaxBodySize
+}
+
+// isJSONRequest reports whether the request content type is JSON or a JSON
+// patch.
+func isJSONRequest(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/json") || (strings.HasPrefix(contentType, "application/") && strings.HasSuffix(contentType, "-json-patch"))
 }
 
 func (rt *RoundTripper) formatJSON() func([]byte) (string, error) {
 	// this is concurrency safe
 	f := rt.FormatJSON
 	if f == nil {
-		return FormatJSON
+		return rt.getRedactor().FormatJSON
 	}
 	return f
 }
 
+func (rt *RoundTripper) retryPolicy() RetryPolicy {
+	// this is concurrency safe
+	p := rt.RetryPolicy
+	if p == nil {
+		return defaultRetryPolicy
+	}
+	return p
+}
+
 func (rt *RoundTripper) log() Logger {
 	// this is concurrency safe
 	l := rt.Logger
@@ -288,103 +510,27 @@ func (rt *RoundTripper) log() Logger {
 // FormatJSON is a default function to pretty-format a JSON body.
 // It will also mask known fields which contain sensitive information.
 func FormatJSON(raw []byte) (string, error) {
-	var rawData interface{}
-
-	err := json.Unmarshal(raw, &rawData)
-	if err != nil {
-		return string(raw), fmt.Errorf("unable to parse OpenStack JSON: %s", err)
-	}
-
-	data, ok := rawData.(map[string]interface{})
-	if !ok {
-		pretty, err := json.MarshalIndent(rawData, "", "  ")
-		if err != nil {
-			return string(raw), fmt.Errorf("unable to re-marshal OpenStack JSON: %s", err)
-		}
-
-		return string(pretty), nil
-	}
-
-	// Mask known password fields
-	if v, ok := data["auth"].(map[string]interface{}); ok {
-		// v2 auth methods
-		if v, ok := v["passwordCredentials"].(map[string]interface{}); ok {
-			v["password"] = "***"
-		}
-		if v, ok := v["token"].(map[string]interface{}); ok {
-			v["id"] = "***"
-		}
-		// v3 auth methods
-		if v, ok := v["identity"].(map[string]interface{}); ok {
-			if v, ok := v["password"].(map[string]interface{}); ok {
-				if v, ok := v["user"].(map[string]interface{}); ok {
-					v["password"] = "***"
-				}
-			}
-			if v, ok := v["application_credential"].(map[string]interface{}); ok {
-				v["secret"] = "***"
-			}
-			if v, ok := v["token"].(map[string]interface{}); ok {
-				v["id"] = "***"
-			}
-		}
-	}
-
-	// Mask EC2 access id and body hash
-	if v, ok := data["credentials"].(map[string]interface{}); ok {
-		var access string
-		if s, ok := v["access"]; ok {
-			access, _ = s.(string)
-			v["access"] = "***"
-		}
-		if _, ok := v["body_hash"]; ok {
-			v["body_hash"] = "***"
-		}
-		if v, ok := v["headers"].(map[string]interface{}); ok {
-			if _, ok := v["Authorization"]; ok {
-				if s, ok := v["Authorization"].(string); ok {
-					v["Authorization"] = strings.Replace(s, access, "***", -1)
-				}
-			}
-		}
-	}
-
-	// Ignore the huge catalog output
-	if v, ok := data["token"].(map[string]interface{}); ok {
-		if _, ok := v["catalog"]; ok {
-			v["catalog"] = "***"
-		}
-	}
-
-	pretty, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return string(raw), fmt.Errorf("unable to re-marshal OpenStack JSON: %s", err)
-	}
-
-	return string(pretty), nil
+	return defaultRedactor.FormatJSON(raw)
 }
 
+// RetryBackoffFunc returns a gophercloud.RetryBackoffFunc, which sleeps for the
+// duration requested by the Retry-After header. Use BackoffOpts to retry
+// responses without the header or with other status codes.
 func RetryBackoffFunc(logger Logger) gophercloud.RetryBackoffFunc {
 	return func(ctx context.Context, respErr *gophercloud.ErrUnexpectedResponseCode, e error, retries uint) error {
-		retryAfter := respErr.ResponseHeader.Get("Retry-After")
-		if retryAfter == "" {
-			return e
-		}
-
-		var sleep time.Duration
-
 		// Parse delay seconds or HTTP date
-		if v, err := strconv.ParseUint(retryAfter, 10, 32); err == nil {
-			sleep = time.Duration(v) * time.Second
-		} else if v, err := time.Parse(http.TimeFormat, retryAfter); err == nil {
-			sleep = time.Until(v)
-		} else {
+		sleep, ok := retryAfter(respErr.ResponseHeader)
+		if !ok {
 			return e
 		}
 
 		l := logger
 		if l != nil {
-			l.Printf("Received StatusTooManyRequests response code sleeping for %s", sleep)
+			if id := requestID(respErr.ResponseHeader); id != "" {
+				l.Printf("Received StatusTooManyRequests response code (request ID: %s) sleeping for %s", id, sleep)
+			} else {
+				l.Printf("Received StatusTooManyRequests response code sleeping for %s", sleep)
+			}
 		}
 		if c := ctx; c != nil {
 			select {
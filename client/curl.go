@@ -0,0 +1,42 @@
+package client
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// curlCommand returns the request as an equivalent curl command line. The
+// sensitive headers and JSON fields are masked, non-JSON bodies are replaced
+// with a reference to the standard input.
+func (rt *RoundTripper) curlCommand(request *http.Request) (string, error) {
+	args := []string{"curl", "-g", "-i", "-X", request.Method, shellQuote(request.URL.String())}
+
+	headers := rt.hideSensitiveHeadersData(request.Header)
+	sort.Strings(headers)
+	for _, h := range headers {
+		args = append(args, "-H", shellQuote(h))
+	}
+
+	if request.Body != nil && request.Body != http.NoBody {
+		if isJSONRequest(request.Header.Get("Content-Type")) {
+			body, err := readRequestBody(request)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, "-d", shellQuote(rt.compactJSON(body)))
+		} else {
+			args = append(args, "--data-binary", "@-")
+		}
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+// shellQuote quotes the value for a POSIX shell, when necessary.
+func shellQuote(v string) string {
+	if v != "" && strings.Trim(v, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return v
+	}
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestCurlCommand(t *testing.T) {
+	rt := &RoundTripper{}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/v3/auth/tokens?nocatalog", strings.NewReader(`{"auth": {"identity": {"methods": ["password"], "password": {"user": {"name": "o'brien", "password": "secret"}}}}}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Auth-Token", "token")
+
+	cmd, err := rt.curlCommand(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `curl -g -i -X POST 'http://example.com/v3/auth/tokens?nocatalog' -H 'Content-Type: application/json' -H 'X-Auth-Token: ***' -d '{"auth":{"identity":{"methods":["password"],"password":{"user":{"name":"o'\''brien","password":"***"}}}}}'`, cmd)
+
+	// the body is still available for the request
+	body, err := io.ReadAll(request.Body)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, strings.Contains(string(body), `"password": "secret"`))
+
+	request, _ = http.NewRequest(http.MethodPut, "http://example.com/v1/AUTH_a/c/o", strings.NewReader("data"))
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	cmd, err = rt.curlCommand(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `curl -g -i -X PUT http://example.com/v1/AUTH_a/c/o -H 'Content-Type: application/octet-stream' --data-binary @-`, cmd)
+}
+
+func TestRoundTripperLogCurl(t *testing.T) {
+	logger := &bufferLogger{}
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt:      transport,
+		Logger:  logger,
+		LogCurl: true,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/v2.1/servers", strings.NewReader(`{"server": {"adminPass": "secret"}}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `OpenStack Request: curl -g -i -X POST http://example.com/v2.1/servers -H 'Content-Type: application/json' -d '{"server":{"adminPass":"***"}}'`, logger.lines[0])
+	th.AssertEquals(t, `{"server": {"adminPass": "secret"}}`, transport.bodies[0])
+}
@@ -100,6 +100,37 @@ Example usage with the custom logger:
 		})
 	}
 
+Example usage with the requests logged as curl commands:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:      &http.Transport{},
+			Logger:  &client.DefaultLogger{},
+			LogCurl: true,
+		},
+	}
+
+The debug output of a request is then a single line, which can be copied to a
+shell after the masked values are replaced:
+
+	[DEBUG] OpenStack Request: curl -g -i -X POST https://nova.example.com/v2.1/servers -H 'Content-Type: application/json' -H 'X-Auth-Token: ***' -d '{"server":{"adminPass":"***","name":"foo"}}'
+
+Example usage with a limited size of the logged bodies:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:             &http.Transport{},
+			Logger:         &client.DefaultLogger{},
+			LogMaxBodySize: 64 << 10,
+		},
+	}
+
+Only the first LogMaxBodySize bytes of the JSON, text, XML and form bodies
+are read for logging, the rest is streamed without buffering. The JSON bodies
+exceeding the limit are not logged, because a partial document cannot be
+masked. The binary bodies, e.g. the image downloads, are summarized by their
+content type and size.
+
 Example usage with additinal headers:
 
 	package example
@@ -142,5 +173,305 @@ Example usage with additinal headers:
 			Region: os.Getenv("OS_REGION_NAME"),
 		})
 	}
+
+Example usage with a custom connection retry policy:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:         &http.Transport{},
+			MaxRetries: 5,
+			RetryPolicy: &client.ExponentialBackoff{
+				InitialInterval: time.Second,
+				MaxInterval:     10 * time.Second,
+				MaxElapsedTime:  time.Minute,
+				// POST and PATCH requests are retried only when explicitly allowed
+				RetryNonIdempotent: false,
+			},
+		},
+	}
+
+Example usage with the structured log/slog logger:
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:               &http.Transport{},
+			StructuredLogger: logger,
+		},
+	}
+
+	// The SlogLogger adapter redirects the free text messages, e.g. the
+	// status code aware retries, into the same logger.
+	backoff := client.BackoffOpts{
+		Logger: client.SlogLogger{Logger: logger},
+	}
+
+The request_body and response_body attributes are limited by LogMaxBodySize
+the same way as the debug log.
+
+Example usage with the Prometheus metrics:
+
+	metrics := &client.Metrics{}
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:      &http.Transport{},
+			Metrics: metrics,
+		},
+	}
+
+	http.Handle("/metrics", metrics)
+
+The IDs in the paths are replaced with placeholders. The paths of the
+resources addressed by their names are kept, up to MaxSeries label sets,
+the later ones are labelled as "{other}".
+
+Example usage with the tracing hooks:
+
+	tracer := &client.InMemoryTracer{}
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:     &http.Transport{},
+			Tracer: tracer,
+		},
+	}
+
+	// requests made with this context become children of the parent span
+	ctx, parent := tracer.StartSpan(context.Background(), "purge project")
+	defer parent.End()
+
+	servers.List(computeClient, nil).AllPages(ctx)
+
+	for _, span := range tracer.Spans() {
+		log.Printf("%s %s %v", span.Name, span.Attributes["openstack.request_id"], span.EndTime.Sub(span.StartTime))
+	}
+
+Example usage with the client-side rate limits:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt: &http.Transport{},
+			RateLimiter: &client.RateLimiter{
+				Limits: map[string]client.RateLimits{
+					"compute": {
+						Read:  client.RateLimit{Rate: 10, Burst: 20},
+						Write: client.RateLimit{Rate: 2},
+					},
+					"cinder.example.com": {
+						Write: client.RateLimit{Rate: 1},
+					},
+				},
+				Default: client.RateLimits{
+					Read:  client.RateLimit{Rate: 20},
+					Write: client.RateLimit{Rate: 5},
+				},
+			},
+		},
+	}
+
+The Default budget applies to each service type separately, or to each host,
+when the service type is unknown. It is not a single budget shared by all the
+other services.
+
+Example usage with a circuit breaker per service endpoint:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:     &http.Transport{},
+			Logger: &client.DefaultLogger{},
+			CircuitBreaker: &client.CircuitBreaker{
+				FailureThreshold: 3,
+				Cooldown:         time.Minute,
+			},
+		},
+	}
+
+	_, err := volumes.Get(ctx, volumeClient, id).Extract()
+	if errors.As(err, &client.ErrCircuitOpen{}) {
+		// requeue without waiting for the retries
+	}
+
+Example usage with a policy denying dangerous requests:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt: &http.Transport{},
+			Policy: &client.Policy{
+				Name: "production",
+				Deny: []client.PolicyRule{
+					{
+						Methods:  []string{http.MethodDelete},
+						Services: []string{"compute"},
+					},
+				},
+			},
+		},
+	}
+
+	err := servers.Delete(ctx, computeClient, id).ExtractErr()
+	if errors.As(err, &client.ErrPolicyDenied{}) {
+		// the request was not sent
+	}
+
+Example usage with the audit trail of the mutating requests:
+
+	audit := client.NewAuditLog("/var/log/openstack/audit.jsonl")
+	audit.Cloud = "production"
+	audit.Region = "RegionOne"
+	audit.MaxSize = 10 << 20
+	defer audit.Close()
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:    &http.Transport{},
+			Audit: audit,
+		},
+	}
+
+Each POST, PUT, PATCH and DELETE request is appended as a JSON line with the
+user and the project of the token and the SHA-256 digest of the masked JSON
+body, before it is sent. The requests are not sent, when the audit log cannot
+be written. Another line with the status code and the request ID is appended,
+when the response is received.
+
+Example usage of the OpenStack request ID capture:
+
+	ctx = client.WithRequestIDCapture(ctx)
+
+	server, err := servers.Create(ctx, computeClient, createOpts).Extract()
+	if err != nil {
+		log.Printf("failed to create a server (request ID: %s): %s", client.RequestIDFromError(err), err)
+		return err
+	}
+	log.Printf("server %s created (request ID: %s)", server.ID, client.LastRequestID(ctx))
+
+Example usage with the conditional GET response cache:
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt: &http.Transport{},
+			Cache: &client.ResponseCache{
+				MaxEntries:  500,
+				MaxBodySize: 256 << 10,
+			},
+		},
+	}
+
+Example usage with additional JSON fields to be masked:
+
+	rt := &client.RoundTripper{
+		Rt:     &http.Transport{},
+		Logger: &client.DefaultLogger{},
+	}
+
+	rules := append(client.GetDefaultRedactionRules(),
+		"server.metadata.db_password",
+		"servers.*.metadata.db_password",
+	)
+	rt.SetRedactionRules(rules)
+
+Example usage of the status code aware retries:
+
+	backoff := client.BackoffOpts{
+		InitialDelay:  time.Second,
+		MaxDelay:      30 * time.Second,
+		MaxTotalDelay: 5 * time.Minute,
+		Logger:        &client.DefaultLogger{},
+	}
+
+	provider.MaxBackoffRetries = 10
+	provider.RetryBackoffFunc = backoff.RetryBackoffFunc()
+	provider.RetryFunc = backoff.RetryFunc()
+
+Example usage with the HTTP Archive (HAR) export:
+
+	har := client.NewHARRecorder("/tmp/openstack.har")
+	defer har.Close()
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:  &http.Transport{},
+			HAR: har,
+		},
+	}
+
+Each exchange is appended to the file, which is a valid HAR document after
+each exchange and can be opened in the browser developer tools or attached to
+a support ticket. The bodies are limited by LogMaxBodySize, the binary ones
+are summarized by their content type and size.
+
+Example usage of the fault injection in tests:
+
+	faults := client.NewFaultInjector(&http.Transport{}, 42,
+		// fail every fifth volume deletion
+		client.FaultRule{
+			Methods:     []string{http.MethodDelete},
+			Services:    []string{"volume"},
+			Probability: 0.2,
+			Fault:       client.Fault{StatusCode: http.StatusServiceUnavailable},
+		},
+		// reset the connection of the first two object uploads
+		client.FaultRule{
+			Methods:  []string{http.MethodPut},
+			Services: []string{"object-store"},
+			Count:    2,
+			Fault:    client.Fault{Latency: time.Second, Reset: true},
+		},
+	)
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:         faults,
+			MaxRetries: 3,
+		},
+	}
+
+Example usage of the dry run transport:
+
+	dryRun := client.NewDryRun(&http.Transport{})
+	dryRun.SetRedactionRules([]string{"server.user_data"})
+
+	provider.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{Rt: dryRun},
+	}
+
+	if err := helpers.ProjectPurgeAll(ctx, projectID, purgeOpts); err != nil {
+		panic(err)
+	}
+
+	for _, r := range dryRun.Plan() {
+		fmt.Printf("%s %s %s\n", r.Method, r.URL, r.Body)
+	}
+
+The GET requests and the Keystone token requests are sent, the mutating
+requests are only recorded and answered with a synthetic response.
+
+Example usage of the record/replay transport in tests:
+
+	mode := client.RecorderModeReplay
+	if os.Getenv("OS_RECORD") != "" {
+		mode = client.RecorderModeRecord
+	}
+
+	recorder, err := client.NewRecorder("testdata/purge.json", mode, &http.Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if mode == client.RecorderModeRecord {
+			recorder.Save()
+		}
+	}()
+
+	opts := &clientconfig.ClientOpts{
+		Cloud: "devstack",
+		HTTPClient: &http.Client{
+			Transport: &client.RoundTripper{Rt: recorder},
+		},
+	}
 */
 package client
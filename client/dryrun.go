@@ -0,0 +1,191 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultDryRunStatusCodes are the status codes of the synthetic responses
+// per HTTP method.
+var DefaultDryRunStatusCodes = map[string]int{
+	http.MethodPost:   http.StatusCreated,
+	http.MethodPut:    http.StatusCreated,
+	http.MethodPatch:  http.StatusOK,
+	http.MethodDelete: http.StatusNoContent,
+}
+
+// PlannedRequest is a mutating request intercepted by the DryRun transport.
+type PlannedRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Service     string `json:"service"`
+	ContentType string `json:"content_type,omitempty"`
+	// Body is the masked JSON body. Other bodies are not recorded.
+	Body     string `json:"body,omitempty"`
+	BodySize int64  `json:"body_size"`
+}
+
+// DryRun is a http.RoundTripper, which lets the read requests through, but
+// intercepts the mutating requests. Instead of sending them, it records them
+// into a plan and returns a synthetic response. It is meant to be set as the
+// RoundTripper.Rt in order to preview the changes.
+//
+// The Keystone token requests are always sent, so the client can still
+// authenticate.
+type DryRun struct {
+	// Default http.RoundTripper
+	Rt http.RoundTripper
+	// StatusCodes are the status codes of the synthetic responses per HTTP
+	// method. Defaults to DefaultDryRunStatusCodes.
+	StatusCodes map[string]int
+	// Respond returns the synthetic response of an intercepted request. It
+	// takes precedence over the StatusCodes.
+	Respond func(request *http.Request) (*http.Response, error)
+	// If Logger is not nil, then the intercepted requests are logged
+	Logger Logger
+
+	// A pointer to a set of JSON paths to be masked in the plan
+	redactor *Redactor
+
+	mu      sync.Mutex
+	plan    []PlannedRequest
+	catalog serviceCatalog
+}
+
+// NewDryRun returns a new DryRun transport.
+func NewDryRun(rt http.RoundTripper) *DryRun {
+	return &DryRun{Rt: rt}
+}
+
+// SetRedactionRules sets the list of JSON paths to be masked in the plan.
+func (d *DryRun) SetRedactionRules(rules []string) {
+	// this is concurrency safe
+	d.redactor = NewRedactor(rules)
+}
+
+// Plan returns a copy of the intercepted requests.
+func (d *DryRun) Plan() []PlannedRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]PlannedRequest(nil), d.plan...)
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (d *DryRun) RoundTrip(request *http.Request) (*http.Response, error) {
+	if isReadMethod(request.Method) || isTokenRequest(request) {
+		// this is concurrency safe
+		rt := d.Rt
+		if rt == nil {
+			return nil, fmt.Errorf("Rt RoundTripper is nil, aborting")
+		}
+		response, err := rt.RoundTrip(request)
+		if err != nil {
+			return response, err
+		}
+		if err := d.catalog.observe(request, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	service, _ := d.catalog.resolve(request.URL)
+	planned := PlannedRequest{
+		Method:      request.Method,
+		URL:         request.URL.String(),
+		Service:     service,
+		ContentType: request.Header.Get("Content-Type"),
+	}
+
+	// the object storage clients compare the ETag with the uploaded data
+	var sum hash.Hash
+	if request.Body != nil && request.Body != http.NoBody {
+		if isJSONRequest(planned.ContentType) {
+			body, err := readRequestBody(request)
+			if err != nil {
+				return nil, err
+			}
+			planned.BodySize = int64(len(body))
+			planned.Body = d.maskJSON(body)
+		} else {
+			sum = md5.New()
+			n, err := io.Copy(sum, request.Body)
+			request.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			planned.BodySize = n
+		}
+	}
+
+	d.mu.Lock()
+	d.plan = append(d.plan, planned)
+	d.mu.Unlock()
+
+	if d.Logger != nil {
+		d.Logger.Printf("Dry run, not sending %s %s", planned.Method, planned.URL)
+	}
+
+	if d.Respond != nil {
+		return d.Respond(request)
+	}
+
+	statusCodes := d.StatusCodes
+	if statusCodes == nil {
+		statusCodes = DefaultDryRunStatusCodes
+	}
+	statusCode, ok := statusCodes[request.Method]
+	if !ok {
+		statusCode = http.StatusNoContent
+	}
+
+	header := http.Header{}
+	body := ""
+	if statusCode != http.StatusNoContent {
+		header.Set("Content-Type", "application/json")
+		body = "{}"
+	}
+	if sum != nil {
+		header.Set("ETag", hex.EncodeToString(sum.Sum(nil)))
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
+
+// maskJSON returns the compact JSON body with the sensitive fields masked.
+func (d *DryRun) maskJSON(body []byte) string {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return ""
+	}
+
+	// this is concurrency safe
+	redactor := d.redactor
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+	redactor.Redact(data)
+
+	masked, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	return string(masked)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestDryRun(t *testing.T) {
+	transport := &flakyTransport{}
+	dryRun := NewDryRun(transport)
+	rt := &RoundTripper{Rt: dryRun}
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusOK, response.StatusCode)
+	th.AssertEquals(t, 1, transport.calls)
+
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers", strings.NewReader(`{"server": {"name": "foo", "adminPass": "secret"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	response, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusCreated, response.StatusCode)
+	body, _ := io.ReadAll(response.Body)
+	th.AssertEquals(t, "{}", string(body))
+
+	request, _ = http.NewRequest(http.MethodPut, "http://example.com:8080/v1/AUTH_test/c/o", strings.NewReader("hello"))
+	request.Header.Set("Content-Type", "text/plain")
+	response, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "5d41402abc4b2a76b9719d911017c592", response.Header.Get("ETag"))
+
+	request, _ = http.NewRequest(http.MethodDelete, "http://example.com:8774/v2.1/servers/1", nil)
+	response, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusNoContent, response.StatusCode)
+
+	// token requests are always sent
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:5000/v3/auth/tokens", strings.NewReader(`{}`))
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, transport.calls)
+
+	th.AssertDeepEquals(t, []PlannedRequest{
+		{
+			Method:      http.MethodPost,
+			URL:         "http://example.com:8774/v2.1/servers",
+			Service:     "compute",
+			ContentType: "application/json",
+			Body:        `{"server":{"adminPass":"***","name":"foo"}}`,
+			BodySize:    50,
+		},
+		{
+			Method:      http.MethodPut,
+			URL:         "http://example.com:8080/v1/AUTH_test/c/o",
+			Service:     "object-store",
+			ContentType: "text/plain",
+			BodySize:    5,
+		},
+		{
+			Method:  http.MethodDelete,
+			URL:     "http://example.com:8774/v2.1/servers/1",
+			Service: "compute",
+		},
+	}, dryRun.Plan())
+}
+
+func TestDryRunRespond(t *testing.T) {
+	dryRun := NewDryRun(&flakyTransport{})
+	dryRun.StatusCodes = map[string]int{http.MethodPost: http.StatusAccepted}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/v2.1/servers/1/action", strings.NewReader(`{"reboot": {"type": "SOFT"}}`))
+	response, err := dryRun.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusAccepted, response.StatusCode)
+
+	dryRun.Respond = func(request *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusConflict,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    request,
+		}, nil
+	}
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com/v2.1/servers/1/action", nil)
+	response, err = dryRun.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusConflict, response.StatusCode)
+	th.AssertEquals(t, 2, len(dryRun.Plan()))
+}
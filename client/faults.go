@@ -0,0 +1,268 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault describes a failure injected by the FaultInjector. The fields may be
+// combined, e.g. a latency followed by a status code.
+type Fault struct {
+	// Latency delays the request.
+	Latency time.Duration
+	// Reset fails the request with a connection reset error without sending
+	// it.
+	Reset bool
+	// StatusCode returns a synthetic response with the status code without
+	// sending the request.
+	StatusCode int
+	// Header contains the headers of the synthetic response, e.g.
+	// Retry-After.
+	Header http.Header
+	// Body is the body of the synthetic response. Defaults to a JSON error
+	// message.
+	Body string
+	// TruncateBody cuts the real response body after TruncateAfter bytes
+	// and fails the further reads with io.ErrUnexpectedEOF.
+	TruncateBody  bool
+	TruncateAfter int
+}
+
+func (f Fault) String() string {
+	var s []string
+	if f.Latency > 0 {
+		s = append(s, fmt.Sprintf("latency of %s", f.Latency))
+	}
+	if f.Reset {
+		s = append(s, "connection reset")
+	}
+	if f.StatusCode > 0 {
+		s = append(s, fmt.Sprintf("status code %d", f.StatusCode))
+	}
+	if f.TruncateBody {
+		s = append(s, fmt.Sprintf("body truncated after %d bytes", f.TruncateAfter))
+	}
+	return strings.Join(s, ", ")
+}
+
+// FaultRule defines which requests get a fault injected. All the set
+// conditions must match.
+type FaultRule struct {
+	// Methods are the HTTP methods the rule applies to. Empty matches all
+	// methods.
+	Methods []string
+	// Services are the service types the rule applies to, e.g. "compute".
+	// Empty matches all services.
+	Services []string
+	// Path is matched against the request URL path. Nil matches all paths.
+	Path *regexp.Regexp
+	// Probability is the chance of the fault injection in the range from 0
+	// to 1. Zero injects the fault into every matching request.
+	Probability float64
+	// Count is the maximum number of injections. Zero means no limit.
+	Count int
+	// Fault is the injected failure.
+	Fault Fault
+}
+
+// FaultInjector is a http.RoundTripper, which injects failures into the
+// requests in order to test the error handling. It is meant to be set as the
+// RoundTripper.Rt, so the injected connection errors go through the
+// connection retries.
+//
+// The first matching rule wins. The random decisions are reproducible under
+// the same seed, as long as the requests are sent sequentially.
+type FaultInjector struct {
+	// Default http.RoundTripper
+	Rt http.RoundTripper
+	// Rules are evaluated in order for each request
+	Rules []FaultRule
+	// If Logger is not nil, then the injected faults are logged
+	Logger Logger
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	counts  []int
+	catalog serviceCatalog
+}
+
+// NewFaultInjector returns a new FaultInjector with a random generator
+// initialized with the seed.
+func NewFaultInjector(rt http.RoundTripper, seed int64, rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{
+		Rt:    rt,
+		Rules: rules,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// match returns the fault to be injected into the request.
+func (f *FaultInjector) match(request *http.Request) (Fault, bool) {
+	service, _ := f.catalog.resolve(request.URL)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rand == nil {
+		f.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if len(f.counts) != len(f.Rules) {
+		f.counts = make([]int, len(f.Rules))
+	}
+
+	for i, r := range f.Rules {
+		if len(r.Methods) > 0 && !containsFold(r.Methods, request.Method) {
+			continue
+		}
+		if len(r.Services) > 0 && !containsFold(r.Services, service) {
+			continue
+		}
+		if r.Path != nil && !r.Path.MatchString(request.URL.Path) {
+			continue
+		}
+		if r.Count > 0 && f.counts[i] >= r.Count {
+			continue
+		}
+		if r.Probability > 0 && f.rand.Float64() >= r.Probability {
+			continue
+		}
+		f.counts[i]++
+		return r.Fault, true
+	}
+
+	return Fault{}, false
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (f *FaultInjector) RoundTrip(request *http.Request) (*http.Response, error) {
+	fault, ok := f.match(request)
+	if !ok {
+		return f.roundTrip(request)
+	}
+
+	if f.Logger != nil {
+		f.Logger.Printf("Injecting %s into %s %s", fault, request.Method, request.URL)
+	}
+
+	if fault.Latency > 0 {
+		if err := sleepContext(request.Context(), fault.Latency); err != nil {
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			return nil, err
+		}
+	}
+
+	if fault.Reset || fault.StatusCode > 0 {
+		if request.Body != nil {
+			request.Body.Close()
+		}
+	}
+
+	if fault.Reset {
+		return nil, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+	}
+
+	if fault.StatusCode > 0 {
+		return faultResponse(request, fault), nil
+	}
+
+	response, err := f.roundTrip(request)
+	if err != nil || !fault.TruncateBody {
+		return response, err
+	}
+
+	response.Body = &truncatedBody{
+		ReadCloser: response.Body,
+		remaining:  fault.TruncateAfter,
+	}
+	// the truncated body is shorter than announced
+	response.ContentLength = -1
+
+	return response, nil
+}
+
+func (f *FaultInjector) roundTrip(request *http.Request) (*http.Response, error) {
+	// this is concurrency safe
+	rt := f.Rt
+	if rt == nil {
+		return nil, fmt.Errorf("Rt RoundTripper is nil, aborting")
+	}
+
+	response, err := rt.RoundTrip(request)
+	if err != nil {
+		return response, err
+	}
+
+	if err := f.catalog.observe(request, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// faultResponse returns a synthetic response with the fault status code.
+func faultResponse(request *http.Request, fault Fault) *http.Response {
+	header := fault.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	body := fault.Body
+	if body == "" {
+		body = fmt.Sprintf(`{"error": {"code": %d, "message": "Injected fault"}}`, fault.StatusCode)
+		header.Set("Content-Type", "application/json")
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fault.StatusCode, http.StatusText(fault.StatusCode)),
+		StatusCode:    fault.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+// truncatedBody fails the reads after the remaining bytes are read.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestFaultInjectorSeed(t *testing.T) {
+	run := func(seed int64) []bool {
+		f := NewFaultInjector(staticTransport{status: http.StatusOK}, seed, FaultRule{
+			Probability: 0.5,
+			Fault:       Fault{StatusCode: http.StatusServiceUnavailable},
+		})
+
+		var injected []bool
+		for i := 0; i < 20; i++ {
+			request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			response, err := f.RoundTrip(request)
+			th.AssertNoErr(t, err)
+			injected = append(injected, response.StatusCode == http.StatusServiceUnavailable)
+		}
+		return injected
+	}
+
+	first := run(42)
+	th.AssertDeepEquals(t, first, run(42))
+
+	var count int
+	for _, v := range first {
+		if v {
+			count++
+		}
+	}
+	if count == 0 || count == len(first) {
+		t.Fatalf("unexpected number of injected faults: %d", count)
+	}
+}
+
+func TestFaultInjectorRules(t *testing.T) {
+	f := NewFaultInjector(staticTransport{status: http.StatusOK, body: `{"servers": []}`}, 1,
+		FaultRule{
+			Methods:  []string{http.MethodDelete},
+			Services: []string{"volume"},
+			Count:    1,
+			Fault: Fault{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": {"1"}},
+			},
+		},
+		FaultRule{
+			Services: []string{"compute"},
+			Path:     regexp.MustCompile(`/servers/detail$`),
+			Fault: Fault{
+				Latency:       time.Millisecond,
+				TruncateBody:  true,
+				TruncateAfter: 5,
+			},
+		},
+	)
+
+	request, _ := http.NewRequest(http.MethodDelete, "http://example.com:8776/v3/volumes/1", nil)
+	response, err := f.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusTooManyRequests, response.StatusCode)
+	th.AssertEquals(t, "1", response.Header.Get("Retry-After"))
+
+	// the rule is exhausted
+	request, _ = http.NewRequest(http.MethodDelete, "http://example.com:8776/v3/volumes/1", nil)
+	response, err = f.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusOK, response.StatusCode)
+
+	request, _ = http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers/detail", nil)
+	response, err = f.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	body, err := io.ReadAll(response.Body)
+	th.AssertEquals(t, io.ErrUnexpectedEOF, err)
+	th.AssertEquals(t, `{"ser`, string(body))
+
+	request, _ = http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/flavors", nil)
+	response, err = f.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	body, err = io.ReadAll(response.Body)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{"servers": []}`, string(body))
+}
+
+func TestFaultInjectorReset(t *testing.T) {
+	logger := &bufferLogger{}
+	f := NewFaultInjector(staticTransport{status: http.StatusOK}, 1, FaultRule{
+		Count: 2,
+		Fault: Fault{Reset: true},
+	})
+	f.Logger = logger
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	_, err := f.RoundTrip(request)
+	th.AssertEquals(t, true, errors.Is(err, syscall.ECONNRESET))
+
+	// the connection retries of the RoundTripper handle the resets
+	rt := &RoundTripper{
+		Rt:          f,
+		MaxRetries:  1,
+		RetryPolicy: &ExponentialBackoff{InitialInterval: time.Millisecond, Jitter: -1},
+	}
+	request, _ = http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusOK, response.StatusCode)
+
+	th.AssertDeepEquals(t, []string{
+		"Injecting connection reset into GET http://example.com/",
+		"Injecting connection reset into GET http://example.com/",
+	}, logger.lines)
+}
@@ -0,0 +1,447 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HARRecorder collects the OpenStack API exchanges in the HTTP Archive (HAR)
+// 1.2 format, which can be opened in the browser developer tools and other
+// HAR viewers. Sensitive headers and JSON fields are masked the same way as
+// in the debug logs, and the bodies are limited by the LogMaxBodySize of the
+// RoundTripper.
+type HARRecorder struct {
+	// Path is the HAR file. Each exchange is appended to it, so the file is
+	// a valid HAR document after each exchange, and the exchanges are not
+	// kept in memory. The exchanges are kept in memory, when the Path is
+	// empty.
+	Path string
+
+	mu      sync.Mutex
+	entries []harEntry
+	file    *os.File
+	// end is the file offset of the HAR document trailer
+	end int64
+	// err is the first error writing the file
+	err error
+	// closed is set by Close, so the file is not truncated by the
+	// following exchanges
+	closed bool
+}
+
+// harHeader and harTrailer enclose the entries of the HAR file.
+const (
+	harHeader  = `{"log": {"version": "1.2", "creator": {"name": "gophercloud-utils", "version": "v2"}, "entries": [` + "\n"
+	harTrailer = "\n]}}\n"
+)
+
+// NewHARRecorder returns a new HARRecorder writing into the path.
+func NewHARRecorder(path string) *HARRecorder {
+	return &HARRecorder{Path: path}
+}
+
+type harLog struct {
+	Log harLogBody `json:"log"`
+}
+
+type harLogBody struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// WriteTo writes the recorded exchanges as a HAR document.
+func (h *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	h.mu.Lock()
+	if h.file != nil {
+		defer h.mu.Unlock()
+		return io.Copy(w, io.NewSectionReader(h.file, 0, h.end+int64(len(harTrailer))))
+	}
+	doc := harLog{
+		Log: harLogBody{
+			Version: "1.2",
+			Creator: harCreator{Name: "gophercloud-utils", Version: "v2"},
+			Entries: append([]harEntry{}, h.entries...),
+		},
+	}
+	h.mu.Unlock()
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// Save flushes the Path file to the disk. It returns the first error
+// appending an exchange to the file.
+func (h *HARRecorder) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.err != nil || h.file == nil {
+		return h.err
+	}
+	return h.file.Sync()
+}
+
+// Close saves and closes the Path file. The following exchanges are not
+// recorded.
+func (h *HARRecorder) Close() error {
+	err := h.Save()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.file != nil {
+		if e := h.file.Close(); err == nil {
+			err = e
+		}
+		h.file = nil
+	}
+	return err
+}
+
+func (h *HARRecorder) add(entry harEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.Path == "" {
+		h.entries = append(h.entries, entry)
+		return nil
+	}
+
+	if err := h.append(entry); err != nil {
+		if h.err == nil {
+			h.err = err
+		}
+		return err
+	}
+	return nil
+}
+
+var errHARRecorderClosed = errors.New("HAR recorder is closed")
+
+// append writes the entry over the trailer of the HAR file followed by the
+// trailer, so the previous entries are never rewritten.
+func (h *HARRecorder) append(entry harEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if h.closed {
+		return errHARRecorderClosed
+	}
+
+	var buf []byte
+	offset := h.end
+	if h.file == nil {
+		f, err := os.OpenFile(h.Path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+		if err != nil {
+			return err
+		}
+		h.file = f
+		buf = append(buf, harHeader...)
+		offset = 0
+	} else {
+		buf = append(buf, ",\n"...)
+	}
+	buf = append(buf, data...)
+
+	if _, err := h.file.WriteAt(append(buf, harTrailer...), offset); err != nil {
+		return err
+	}
+	h.end = offset + int64(len(buf))
+
+	return nil
+}
+
+// harTimer collects the connection timings of a request.
+type harTimer struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *harTimer) set(v *time.Time, first bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if first && !v.IsZero() {
+		return
+	}
+	*v = time.Now()
+}
+
+func (t *harTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.set(&t.dnsStart, true) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone, false) },
+		ConnectStart:         func(string, string) { t.set(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { t.set(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone, false) },
+		GotConn:              func(httptrace.GotConnInfo) { t.set(&t.gotConn, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte, false) },
+	}
+}
+
+// timings returns the HAR timings of the request, which finished at the end
+// time.
+func (t *harTimer) timings(end time.Time) harTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// ms returns the duration between a and b in milliseconds or -1, when
+	// any of them is unknown
+	ms := func(a, b time.Time) float64 {
+		if a.IsZero() || b.IsZero() || b.Before(a) {
+			return -1
+		}
+		return float64(b.Sub(a)) / float64(time.Millisecond)
+	}
+	zero := func(v float64) float64 {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+
+	timings := harTimings{
+		DNS:     ms(t.dnsStart, t.dnsDone),
+		Connect: ms(t.connectStart, t.connectDone),
+		SSL:     ms(t.tlsStart, t.tlsDone),
+		Send:    zero(ms(t.gotConn, t.wroteRequest)),
+		Wait:    zero(ms(t.wroteRequest, t.firstByte)),
+		Receive: zero(ms(t.firstByte, end)),
+	}
+	// the HAR connect time includes the SSL handshake
+	if timings.Connect >= 0 && timings.SSL >= 0 {
+		timings.Connect = zero(ms(t.connectStart, t.tlsDone))
+	}
+
+	switch {
+	case !t.dnsStart.IsZero():
+		timings.Blocked = ms(t.start, t.dnsStart)
+	case !t.connectStart.IsZero():
+		timings.Blocked = ms(t.start, t.connectStart)
+	default:
+		timings.Blocked = ms(t.start, t.gotConn)
+	}
+
+	return timings
+}
+
+// recordHAR returns a step, which adds each exchange to the HAR recorder.
+func (rt *RoundTripper) recordHAR(h *HARRecorder, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		timer := &harTimer{start: time.Now()}
+		request = request.WithContext(httptrace.WithClientTrace(request.Context(), timer.clientTrace()))
+
+		entry := harEntry{
+			StartedDateTime: timer.start.Format(time.RFC3339Nano),
+			Request: harRequest{
+				Method:      request.Method,
+				URL:         request.URL.String(),
+				HTTPVersion: defaultIfEmpty(request.Proto, "HTTP/1.1"),
+				Cookies:     []harNameValue{},
+				QueryString: harQueryString(request),
+				HeadersSize: -1,
+				BodySize:    request.ContentLength,
+			},
+			Response: harResponse{
+				Cookies:     []harNameValue{},
+				Headers:     []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+		}
+
+		contentType := request.Header.Get("Content-Type")
+		if request.Body != nil && request.Body != http.NoBody {
+			text, size, body, err := rt.peekRequestBody(request.Body, contentType, request.ContentLength, rt.harJSON)
+			if err != nil {
+				return nil, err
+			}
+			request.Body = body
+			entry.Request.BodySize = size
+			entry.Request.PostData = &harPostData{MimeType: contentType, Text: text}
+		} else {
+			entry.Request.BodySize = 0
+		}
+
+		response, err := next(request)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+
+		// the additional headers are set during the round-trip
+		entry.Request.Headers = rt.harHeaders(request.Header)
+
+		if response != nil {
+			contentType := response.Header.Get("Content-Type")
+			entry.Response.Status = response.StatusCode
+			entry.Response.StatusText = http.StatusText(response.StatusCode)
+			entry.Response.HTTPVersion = defaultIfEmpty(response.Proto, "HTTP/1.1")
+			entry.Response.Headers = rt.harHeaders(response.Header)
+			entry.Response.RedirectURL = response.Header.Get("Location")
+
+			text, size, body, e := rt.peekResponseBody(response.Body, contentType, response.ContentLength, rt.harJSON)
+			if e != nil {
+				response.Body.Close()
+				return nil, e
+			}
+			response.Body = body
+			entry.Response.BodySize = size
+			entry.Response.Content = harContent{
+				Size:     size,
+				MimeType: contentType,
+				Text:     text,
+			}
+		}
+
+		end := time.Now()
+		entry.Time = float64(end.Sub(timer.start)) / float64(time.Millisecond)
+		entry.Timings = timer.timings(end)
+
+		if e := h.add(entry); e != nil && rt.Logger != nil {
+			rt.log().Printf("Failed to save the HAR file: %s", e)
+		}
+
+		return response, err
+	}
+}
+
+// harJSON formats the JSON body for the HAR file.
+func (rt *RoundTripper) harJSON(body []byte) string {
+	text, _ := rt.formatJSON()(body)
+	return text
+}
+
+// harHeaders converts the headers into a sorted HAR list with masked
+// sensitive headers.
+func (rt *RoundTripper) harHeaders(headers http.Header) []harNameValue {
+	maskHeaders := rt.sensitiveHeaders()
+
+	result := []harNameValue{}
+	for k, values := range headers {
+		_, masked := maskHeaders[strings.ToLower(k)]
+		for _, v := range values {
+			if masked {
+				v = "***"
+			}
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func harQueryString(request *http.Request) []harNameValue {
+	result := []harNameValue{}
+	query := request.URL.Query()
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range query[k] {
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestRoundTripperHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": {"catalog": [{"type": "compute"}], "methods": ["password"]}}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "session.har")
+	rt := &RoundTripper{
+		Rt:  http.DefaultTransport,
+		HAR: NewHARRecorder(path),
+	}
+	rt.SetHeaders(http.Header{"User-Agent": {"test"}})
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/auth/tokens?nocatalog=false", strings.NewReader(`{"auth": {"identity": {"password": {"user": {"name": "jdoe", "password": "secret"}}}}}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	response.Body.Close()
+
+	data, err := os.ReadFile(path)
+	th.AssertNoErr(t, err)
+
+	var har harLog
+	th.AssertNoErr(t, json.Unmarshal(data, &har))
+	th.AssertEquals(t, "1.2", har.Log.Version)
+	th.AssertEquals(t, 1, len(har.Log.Entries))
+
+	entry := har.Log.Entries[0]
+	th.AssertEquals(t, http.MethodPost, entry.Request.Method)
+	th.AssertDeepEquals(t, []harNameValue{{Name: "nocatalog", Value: "false"}}, entry.Request.QueryString)
+	th.AssertDeepEquals(t, []harNameValue{
+		{Name: "Content-Type", Value: "application/json"},
+		{Name: "User-Agent", Value: "test"},
+	}, entry.Request.Headers)
+	th.AssertEquals(t, true, strings.Contains(entry.Request.PostData.Text, `"password": "***"`))
+	th.AssertEquals(t, false, strings.Contains(entry.Request.PostData.Text, "secret"))
+
+	th.AssertEquals(t, http.StatusCreated, entry.Response.Status)
+	th.AssertEquals(t, "Created", entry.Response.StatusText)
+	for _, h := range entry.Response.Headers {
+		if h.Name == "X-Subject-Token" {
+			th.AssertEquals(t, "***", h.Value)
+		}
+	}
+	th.AssertEquals(t, true, strings.Contains(entry.Response.Content.Text, `"catalog": "***"`))
+	th.AssertEquals(t, int64(len(`{"token": {"catalog": [{"type": "compute"}], "methods": ["password"]}}`)), entry.Response.Content.Size)
+
+	if entry.Time <= 0 || entry.Timings.Connect < 0 || entry.Timings.SSL != -1 {
+		t.Fatalf("unexpected timings: %v %+v", entry.Time, entry.Timings)
+	}
+}
+
+func TestRoundTripperHARAppend(t *testing.T) {
+	image := &countingReader{}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			if request.Method == http.MethodGet {
+				return &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+					Body:          image,
+					ContentLength: 1 << 40,
+					Request:       request,
+				}, nil
+			}
+			return staticTransport{
+				status:  http.StatusOK,
+				headers: http.Header{"Content-Type": {"text/plain"}},
+				body:    "0123456789abcdef",
+			}.RoundTrip(request)
+		}),
+		LogMaxBodySize: 10,
+	}
+
+	path := filepath.Join(t.TempDir(), "session.har")
+	rt.HAR = NewHARRecorder(path)
+
+	for i := 1; i <= 3; i++ {
+		request, _ := http.NewRequest(http.MethodPut, "http://example.com:9292/v2/images/1/file", strings.NewReader("0123456789abcdef"))
+		request.Header.Set("Content-Type", "text/plain")
+		_, err := rt.RoundTrip(request)
+		th.AssertNoErr(t, err)
+
+		// the file is a valid HAR document after each exchange
+		data, err := os.ReadFile(path)
+		th.AssertNoErr(t, err)
+		var har harLog
+		th.AssertNoErr(t, json.Unmarshal(data, &har))
+		th.AssertEquals(t, i, len(har.Log.Entries))
+	}
+	th.AssertEquals(t, 0, len(rt.HAR.entries))
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:9292/v2/images/1/file", nil)
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, io.ReadCloser(image), response.Body)
+	th.AssertEquals(t, int64(0), image.read)
+	th.AssertNoErr(t, rt.HAR.Close())
+
+	data, err := os.ReadFile(path)
+	th.AssertNoErr(t, err)
+	var har harLog
+	th.AssertNoErr(t, json.Unmarshal(data, &har))
+	th.AssertEquals(t, 4, len(har.Log.Entries))
+
+	// the bodies are limited
+	th.AssertEquals(t, "0123456789... <truncated>", har.Log.Entries[0].Request.PostData.Text)
+	th.AssertEquals(t, "0123456789... <truncated>", har.Log.Entries[0].Response.Content.Text)
+	th.AssertEquals(t, "<binary application/octet-stream body of 1099511627776 bytes>", har.Log.Entries[3].Response.Content.Text)
+	th.AssertEquals(t, int64(1<<40), har.Log.Entries[3].Response.Content.Size)
+
+	// the exchanges after Close don't truncate the file
+	request, _ = http.NewRequest(http.MethodPut, "http://example.com:9292/v2/images/1/file", strings.NewReader("0123456789abcdef"))
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, errHARRecorderClosed, rt.HAR.Save())
+
+	data, err = os.ReadFile(path)
+	th.AssertNoErr(t, err)
+	th.AssertNoErr(t, json.Unmarshal(data, &har))
+	th.AssertEquals(t, 4, len(har.Log.Entries))
+}
+
+// failingBody fails to be read and records whether it was closed.
+type failingBody struct {
+	closed bool
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func (b *failingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRoundTripperHARBodyError(t *testing.T) {
+	body := &failingBody{}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/json"}},
+				Body:          body,
+				ContentLength: -1,
+				Request:       request,
+			}, nil
+		}),
+		HAR: NewHARRecorder(""),
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertErr(t, err)
+	th.AssertEquals(t, true, body.closed)
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// DefaultLogMaxBodySize is the maximum number of the logged body bytes used
+// by RoundTripper when the LogMaxBodySize is not set.
+const DefaultLogMaxBodySize = 1 << 20
+
+// List of form fields that contain sensitive data, e.g. in the OAuth 2.0 token
+// requests.
+var defaultSensitiveFormFields = map[string]struct{}{
+	"password":      {},
+	"client_secret": {},
+	"access_token":  {},
+	"refresh_token": {},
+	"id_token":      {},
+	"assertion":     {},
+	"code":          {},
+	"passcode":      {},
+}
+
+// isJSONContentType reports whether the content type is a JSON based media
+// type, e.g. application/vnd.openstack.compute+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasSuffix(mediaType, "+json")
+}
+
+// isTextContentType reports whether the body of the content type is safe to
+// be logged as text.
+func isTextContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// maskFormBody masks the sensitive values of a URL encoded form. The body may
+// be truncated.
+func maskFormBody(body string) string {
+	pairs := strings.Split(body, "&")
+	for i, p := range pairs {
+		k, _, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			key = k
+		}
+		if _, ok := defaultSensitiveFormFields[strings.ToLower(key)]; ok {
+			pairs[i] = k + "=***"
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// peekedBody returns a body, which reads the already read part first and then
+// the rest of the original body.
+func peekedBody(peeked []byte, original io.ReadCloser) io.ReadCloser {
+	if len(peeked) == 0 {
+		return original
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), original), original}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+// countingReader counts the bytes read from an endless body.
+type countingReader struct {
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func (r *countingReader) Close() error {
+	return nil
+}
+
+func bodyLines(lines []string) []string {
+	var body []string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "OpenStack Request Body") || strings.HasPrefix(l, "OpenStack Response Body") {
+			body = append(body, l)
+		}
+	}
+	return body
+}
+
+func TestLogBinaryBody(t *testing.T) {
+	logger := &bufferLogger{}
+	image := &countingReader{}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+				Body:          image,
+				ContentLength: 1 << 40,
+				Request:       request,
+			}, nil
+		}),
+		Logger: logger,
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:9292/v2/images/1/file", nil)
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, int64(0), image.read)
+	th.AssertEquals(t, io.ReadCloser(image), response.Body)
+
+	th.AssertDeepEquals(t, []string{
+		"OpenStack Response Body: <binary application/octet-stream body of 1099511627776 bytes>",
+	}, bodyLines(logger.lines))
+}
+
+func TestLogTextBody(t *testing.T) {
+	logger := &bufferLogger{}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			io.Copy(io.Discard, request.Body)
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+				Body:          io.NopCloser(strings.NewReader("0123456789abcdef")),
+				ContentLength: -1,
+				Request:       request,
+			}, nil
+		}),
+		Logger:         logger,
+		LogMaxBodySize: 10,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com:5000/v3/OS-FEDERATION/token", strings.NewReader("grant_type=password&username=jdoe&password=secret"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	// the truncated body is still returned whole
+	body, err := io.ReadAll(response.Body)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "0123456789abcdef", string(body))
+
+	th.AssertDeepEquals(t, []string{
+		"OpenStack Request Body: grant_type... <truncated>",
+		"OpenStack Response Body: 0123456789... <truncated>",
+	}, bodyLines(logger.lines))
+
+	logger.lines = nil
+	rt.LogMaxBodySize = 0
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:5000/v3/OS-FEDERATION/token", strings.NewReader("grant_type=password&username=jdoe&password=secret"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "OpenStack Request Body: grant_type=password&username=jdoe&password=***", bodyLines(logger.lines)[0])
+}
+
+func TestLogLargeJSONBody(t *testing.T) {
+	logger := &bufferLogger{}
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt:             transport,
+		Logger:         logger,
+		LogMaxBodySize: 16,
+	}
+
+	payload := `{"server": {"name": "foo", "adminPass": "secret"}}`
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers", strings.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, payload, transport.bodies[0])
+
+	th.AssertDeepEquals(t, []string{
+		"OpenStack Request Body: <JSON body larger than 16 bytes is not logged>",
+	}, bodyLines(logger.lines))
+}
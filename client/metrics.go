@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsObserver is an instrumentation hook, which is called by the
+// RoundTripper once per request, after the retries are finished. The status
+// is zero, when no response was received.
+type MetricsObserver interface {
+	ObserveRequest(service, method, path string, status int, duration time.Duration)
+}
+
+// DefaultMetricsBuckets are the default latency histogram buckets in seconds.
+var DefaultMetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultMetricsMaxSeries is the default number of the label sets kept by
+// Metrics.
+const DefaultMetricsMaxSeries = 1000
+
+// metricsOtherPath is the path label of the requests observed, after the
+// number of the label sets reached the MaxSeries.
+const metricsOtherPath = "{other}"
+
+// Metrics is a MetricsObserver, which counts requests and records latency
+// histograms labelled by the service type, HTTP method, path template and
+// status code. It satisfies the http.Handler interface and exposes the
+// metrics in the Prometheus text format.
+type Metrics struct {
+	// Namespace is the metric names prefix. Defaults to "openstack_client".
+	Namespace string
+	// Buckets are the latency histogram upper bounds in seconds.
+	// Defaults to DefaultMetricsBuckets. The changed buckets apply only to
+	// the new label sets.
+	Buckets []float64
+	// MaxSeries is the number of the label sets kept. The new paths are
+	// labelled as "{other}" once it is reached, as the paths addressing the
+	// resources by their names, e.g. the images or the stacks, are not
+	// collapsed into placeholders. Defaults to DefaultMetricsMaxSeries.
+	MaxSeries int
+
+	mu     sync.Mutex
+	series map[metricsKey]*metricsSeries
+}
+
+type metricsKey struct {
+	service string
+	method  string
+	path    string
+	status  string
+}
+
+type metricsSeries struct {
+	count uint64
+	sum   float64
+	// bounds are the bucket upper bounds at the series creation
+	bounds  []float64
+	buckets []uint64
+}
+
+// ObserveRequest satisfies the MetricsObserver interface.
+func (m *Metrics) ObserveRequest(service, method, path string, status int, duration time.Duration) {
+	key := metricsKey{
+		service: service,
+		method:  method,
+		path:    path,
+		status:  strconv.Itoa(status),
+	}
+	if status == 0 {
+		key.status = "error"
+	}
+
+	buckets := m.buckets()
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.series == nil {
+		m.series = make(map[metricsKey]*metricsSeries)
+	}
+	s, ok := m.series[key]
+	if !ok && len(m.series) >= m.maxSeries() {
+		key.path = metricsOtherPath
+		s, ok = m.series[key]
+	}
+	if !ok {
+		s = &metricsSeries{
+			bounds:  append([]float64(nil), buckets...),
+			buckets: make([]uint64, len(buckets)),
+		}
+		m.series[key] = s
+	}
+
+	s.count++
+	s.sum += seconds
+	for i, le := range s.bounds {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.writeTo(bw)
+	bw.Flush()
+}
+
+func (m *Metrics) writeTo(w *bufio.Writer) {
+	namespace := m.Namespace
+	if namespace == "" {
+		namespace = "openstack_client"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricsKey, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	name := namespace + "_requests_total"
+	fmt.Fprintf(w, "# HELP %s Total number of OpenStack API requests.\n", name)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, k.labels(), m.series[k].count)
+	}
+
+	name = namespace + "_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s OpenStack API request latency in seconds.\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, k := range keys {
+		s := m.series[k]
+		labels := k.labels()
+		for i, le := range s.bounds {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, s.count)
+	}
+}
+
+func (m *Metrics) buckets() []float64 {
+	if len(m.Buckets) == 0 {
+		return DefaultMetricsBuckets
+	}
+	return m.Buckets
+}
+
+func (m *Metrics) maxSeries() int {
+	if m.MaxSeries > 0 {
+		return m.MaxSeries
+	}
+	return DefaultMetricsMaxSeries
+}
+
+func (k metricsKey) labels() string {
+	return fmt.Sprintf(`service="%s",method="%s",path="%s",status="%s"`,
+		escapeLabel(k.service), escapeLabel(k.method), escapeLabel(k.path), escapeLabel(k.status))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// instrument returns a step, which reports each request to the observer.
+func (rt *RoundTripper) instrument(m MetricsObserver, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		start := time.Now()
+		response, err := next(request)
+		duration := time.Since(start)
+
+		var status int
+		if response != nil {
+			status = response.StatusCode
+		}
+
+		service, path := rt.resolveService(request.URL)
+		m.ObserveRequest(service, request.Method, pathTemplate(service, path), status, duration)
+
+		return response, err
+	}
+}
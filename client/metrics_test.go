@@ -0,0 +1,133 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		service  string
+		path     string
+		expected string
+	}{
+		{"compute", "/v2.1/servers/0b3e2ab7-2a7b-4e4d-9c1e-0d8c1e7f4b3a/action", "/v2.1/servers/{id}/action"},
+		{"compute", "/v2.1/2a6b9f4e8c5d4b1a9e3f7c2d1b0a9e8f/flavors/42", "/v2.1/{id}/flavors/{id}"},
+		{"network", "/v2.0/ports", "/v2.0/ports"},
+		{"object-store", "/v1/AUTH_test/container/dir/object", "/v1/{account}/{container}/{object}"},
+		{"object-store", "/container/dir/object", "/{container}/{object}"},
+		{"object-store", "/v1/AUTH_test", "/v1/{account}"},
+		{"object-store", "/info", "/info"},
+	}
+
+	for _, test := range tests {
+		th.AssertEquals(t, test.expected, pathTemplate(test.service, test.path))
+	}
+}
+
+func TestResolveService(t *testing.T) {
+	rt := &RoundTripper{}
+
+	u, _ := url.Parse("https://cloud.example.com:8774/v2.1/servers")
+	service, path := rt.resolveService(u)
+	th.AssertEquals(t, "compute", service)
+	th.AssertEquals(t, "/v2.1/servers", path)
+
+	u, _ = url.Parse("https://cloud.example.com/volume/v3/volumes")
+	service, path = rt.resolveService(u)
+	th.AssertEquals(t, "volume", service)
+	th.AssertEquals(t, "/v3/volumes", path)
+
+	rt.learnServiceEndpoints([]byte(`{"token": {"catalog": [
+		{"type": "compute", "endpoints": [{"url": "https://api.example.com/compute/v2.1"}]},
+		{"type": "object-store", "endpoints": [{"url": "https://api.example.com/swift/v1/AUTH_test"}]}
+	]}}`))
+
+	u, _ = url.Parse("https://api.example.com/compute/v2.1/servers/detail")
+	service, path = rt.resolveService(u)
+	th.AssertEquals(t, "compute", service)
+	th.AssertEquals(t, "/servers/detail", path)
+
+	u, _ = url.Parse("https://api.example.com/swift/v1/AUTH_test/container/object")
+	service, path = rt.resolveService(u)
+	th.AssertEquals(t, "object-store", service)
+	th.AssertEquals(t, "/{container}/{object}", pathTemplate(service, path))
+
+	u, _ = url.Parse("https://other.example.com/foo")
+	service, _ = rt.resolveService(u)
+	th.AssertEquals(t, "unknown", service)
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := &Metrics{Buckets: []float64{0.1, 1}}
+	rt := &RoundTripper{
+		Rt:      staticTransport{status: http.StatusOK, headers: http.Header{}},
+		Metrics: m,
+	}
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodGet, "https://cloud.example.com:9696/v2.0/networks/0b3e2ab7-2a7b-4e4d-9c1e-0d8c1e7f4b3a", nil)
+		_, err := rt.RoundTrip(request)
+		th.AssertNoErr(t, err)
+	}
+	m.ObserveRequest("compute", http.MethodDelete, "/v2.1/servers/{id}", 0, 2*time.Second)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	th.AssertEquals(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	expected := []string{
+		"# TYPE openstack_client_requests_total counter",
+		`openstack_client_requests_total{service="compute",method="DELETE",path="/v2.1/servers/{id}",status="error"} 1`,
+		`openstack_client_requests_total{service="network",method="GET",path="/v2.0/networks/{id}",status="200"} 2`,
+		"# TYPE openstack_client_request_duration_seconds histogram",
+		`openstack_client_request_duration_seconds_bucket{service="compute",method="DELETE",path="/v2.1/servers/{id}",status="error",le="1"} 0`,
+		`openstack_client_request_duration_seconds_bucket{service="compute",method="DELETE",path="/v2.1/servers/{id}",status="error",le="+Inf"} 1`,
+		`openstack_client_request_duration_seconds_sum{service="compute",method="DELETE",path="/v2.1/servers/{id}",status="error"} 2`,
+		`openstack_client_request_duration_seconds_count{service="network",method="GET",path="/v2.0/networks/{id}",status="200"} 2`,
+	}
+	for _, v := range expected {
+		if !strings.Contains(body, v+"\n") {
+			t.Errorf("missing %q in:\n%s", v, body)
+		}
+	}
+}
+
+func TestMetricsLimits(t *testing.T) {
+	m := &Metrics{Buckets: []float64{1}, MaxSeries: 2}
+
+	m.ObserveRequest("image", http.MethodGet, "/v2/images/one", 200, time.Second)
+	m.ObserveRequest("image", http.MethodGet, "/v2/images/two", 200, time.Second)
+
+	// the buckets may grow after the first observation
+	m.Buckets = []float64{1, 10}
+	m.ObserveRequest("image", http.MethodGet, "/v2/images/three", 200, time.Second)
+	m.ObserveRequest("image", http.MethodGet, "/v2/images/four", 200, time.Second)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	expected := []string{
+		`openstack_client_requests_total{service="image",method="GET",path="/v2/images/one",status="200"} 1`,
+		`openstack_client_requests_total{service="image",method="GET",path="{other}",status="200"} 2`,
+		`openstack_client_request_duration_seconds_bucket{service="image",method="GET",path="/v2/images/one",status="200",le="1"} 1`,
+		`openstack_client_request_duration_seconds_bucket{service="image",method="GET",path="{other}",status="200",le="10"} 2`,
+	}
+	for _, v := range expected {
+		if !strings.Contains(body, v+"\n") {
+			t.Errorf("missing %q in:\n%s", v, body)
+		}
+	}
+	if strings.Contains(body, "/v2/images/three") {
+		t.Errorf("unexpected path in:\n%s", body)
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// ErrPolicyDenied is returned without sending the request, when the request
+// is denied by the Policy.
+type ErrPolicyDenied struct {
+	// Policy is the name of the policy, e.g. the cloud name.
+	Policy  string
+	Method  string
+	URL     string
+	Service string
+	// Reason explains why the request was denied.
+	Reason string
+}
+
+func (e ErrPolicyDenied) Error() string {
+	name := ""
+	if e.Policy != "" {
+		name = fmt.Sprintf(" %q", e.Policy)
+	}
+	return fmt.Sprintf("OpenStack %s request to %s denied by policy%s: %s", e.Method, e.URL, name, e.Reason)
+}
+
+// PolicyRule matches the requests denied by the Policy. All the set
+// conditions must match.
+type PolicyRule struct {
+	// Methods are the HTTP methods the rule applies to. Empty matches all
+	// methods.
+	Methods []string
+	// Services are the service types the rule applies to, e.g. "compute".
+	// Empty matches all services. The requests, which service is unknown,
+	// are matched as well.
+	Services []string
+	// Path is matched against the request URL path. Nil matches all paths.
+	Path *regexp.Regexp
+	// Reason is reported in the ErrPolicyDenied. Defaults to a description
+	// of the rule.
+	Reason string
+}
+
+func (r PolicyRule) match(request *http.Request, service string) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, request.Method) {
+		return false
+	}
+	// the request to an unknown service may be to one of the services
+	if len(r.Services) > 0 && service != "unknown" && !containsFold(r.Services, service) {
+		return false
+	}
+	if r.Path != nil && !r.Path.MatchString(request.URL.Path) {
+		return false
+	}
+	return true
+}
+
+func (r PolicyRule) reason() string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+
+	s := "matches a deny rule"
+	if len(r.Methods) > 0 {
+		s += fmt.Sprintf(", methods %v", r.Methods)
+	}
+	if len(r.Services) > 0 {
+		s += fmt.Sprintf(", services %v", r.Services)
+	}
+	if r.Path != nil {
+		s += fmt.Sprintf(", path %q", r.Path)
+	}
+	return s
+}
+
+// Policy guards against dangerous operations, e.g. deleting the servers of a
+// production cloud. The denied requests are never sent.
+//
+// The Keystone token requests are always allowed, so the client can still
+// authenticate with a password or a token. The other auth flows, e.g. OpenID
+// Connect, are not recognized, so the policy should be installed after the
+// provider client is authenticated. The service types are resolved from the service catalog of
+// the token, see SetServiceEndpoints. A rule with Services fails closed and
+// denies the requests, which service is unknown.
+type Policy struct {
+	// Name is reported in the ErrPolicyDenied, e.g. the cloud name.
+	Name string
+	// ReadOnly denies all but the GET, HEAD and OPTIONS requests.
+	ReadOnly bool
+	// Deny are the rules matching the denied requests.
+	Deny []PolicyRule
+}
+
+// Check returns an ErrPolicyDenied, when the request to the service is
+// denied.
+func (p *Policy) Check(request *http.Request, service string) error {
+	if isTokenRequest(request) {
+		return nil
+	}
+
+	deny := func(reason string) error {
+		return ErrPolicyDenied{
+			Policy:  p.Name,
+			Method:  request.Method,
+			URL:     request.URL.String(),
+			Service: service,
+			Reason:  reason,
+		}
+	}
+
+	if p.ReadOnly && !isReadMethod(request.Method) {
+		return deny("read-only mode")
+	}
+
+	for _, r := range p.Deny {
+		if r.match(request, service) {
+			return deny(r.reason())
+		}
+	}
+
+	return nil
+}
+
+// enforcePolicy returns a step, which fails the requests denied by the
+// policy.
+func (rt *RoundTripper) enforcePolicy(p *Policy, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		service, _ := rt.resolveService(request.URL)
+		if err := p.Check(request, service); err != nil {
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			if rt.Logger != nil {
+				rt.log().Printf("%s", err)
+			}
+			return nil, err
+		}
+
+		return next(request)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestPolicyDeny(t *testing.T) {
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt: transport,
+		Policy: &Policy{
+			Name: "prod",
+			Deny: []PolicyRule{
+				{
+					Methods:  []string{http.MethodDelete},
+					Services: []string{"compute"},
+				},
+				{
+					Methods: []string{http.MethodPost},
+					Path:    regexp.MustCompile(`/action$`),
+					Reason:  "no server actions",
+				},
+			},
+		},
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, "http://example.com:8774/v2.1/servers/1", nil)
+	_, err := rt.RoundTrip(request)
+	var denied ErrPolicyDenied
+	th.AssertEquals(t, true, errors.As(err, &denied))
+	th.AssertEquals(t, "compute", denied.Service)
+	th.AssertEquals(t, `OpenStack DELETE request to http://example.com:8774/v2.1/servers/1 denied by policy "prod": matches a deny rule, methods [DELETE], services [compute]`, err.Error())
+
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers/1/action", strings.NewReader(`{"reboot": {}}`))
+	_, err = rt.RoundTrip(request)
+	th.AssertEquals(t, true, errors.As(err, &denied))
+	th.AssertEquals(t, "no server actions", denied.Reason)
+	th.AssertEquals(t, 0, transport.calls)
+
+	// other services are not affected
+	request, _ = http.NewRequest(http.MethodDelete, "http://example.com:8776/v3/volumes/1", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 1, transport.calls)
+
+	// the requests to an unknown service are denied
+	request, _ = http.NewRequest(http.MethodDelete, "http://example.com/v2.1/servers/1", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertEquals(t, true, errors.As(err, &denied))
+	th.AssertEquals(t, "unknown", denied.Service)
+	th.AssertEquals(t, 1, transport.calls)
+
+	// until the service endpoints are known
+	rt.SetServiceEndpoints(map[string]string{"http://example.com/v3": "volume"})
+	request, _ = http.NewRequest(http.MethodDelete, "http://example.com/v3/volumes/1", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, transport.calls)
+}
+
+func TestPolicyReadOnly(t *testing.T) {
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt:     transport,
+		Policy: &Policy{ReadOnly: true},
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	// the token requests are always allowed
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com:5000/v3/auth/tokens", strings.NewReader(`{}`))
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, transport.calls)
+
+	request, _ = http.NewRequest(http.MethodPut, "http://example.com:8080/v1/AUTH_test/c", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertEquals(t, `OpenStack PUT request to http://example.com:8080/v1/AUTH_test/c denied by policy: read-only mode`, err.Error())
+	th.AssertEquals(t, 2, transport.calls)
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket budget.
+type RateLimit struct {
+	// Rate is the number of requests per second. Zero or a negative value
+	// disables the limit.
+	Rate float64
+	// Burst is the maximum number of requests, which may be sent at once.
+	// Defaults to the Rate rounded up, but at least 1.
+	Burst int
+}
+
+// RateLimits holds separate budgets for the read and the mutating requests.
+type RateLimits struct {
+	// Read is the budget of the GET, HEAD and OPTIONS requests.
+	Read RateLimit
+	// Write is the budget of all the other requests.
+	Write RateLimit
+}
+
+// RateLimiter is a client-side token bucket rate limiter. Requests, which
+// exceed the budget, wait until a token is available or the request context
+// is done.
+type RateLimiter struct {
+	// Limits is a map of budgets keyed either by a host, e.g.
+	// "nova.example.com" or "nova.example.com:8774", or by a service type,
+	// e.g. "compute". A host takes precedence over a service type.
+	Limits map[string]RateLimits
+	// Default is the budget of the requests, which don't match any of the
+	// Limits keys. It is not a global budget, each service type has its own
+	// bucket, or each host, when the service type is unknown.
+	Default RateLimits
+
+	mu      sync.Mutex
+	buckets map[rateLimitKey]*tokenBucket
+}
+
+type rateLimitKey struct {
+	key   string
+	write bool
+	// fallback is set for the buckets of the default budget, so they don't
+	// clash with the Limits keys
+	fallback bool
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns the time to wait until it is available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// isReadMethod reports whether the method doesn't modify any resources.
+func isReadMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// limit returns the budget of the request and the key of its bucket.
+func (l *RateLimiter) limit(request *http.Request, service string) (RateLimit, rateLimitKey) {
+	key := rateLimitKey{write: !isReadMethod(request.Method)}
+	known := service != "" && service != "unknown"
+
+	keys := []string{request.URL.Host, request.URL.Hostname()}
+	if known {
+		keys = append(keys, service)
+	}
+
+	limits, ok := l.Default, false
+	for _, k := range keys {
+		if limits, ok = l.Limits[k]; ok {
+			key.key = k
+			break
+		}
+	}
+
+	// the default budget is per service type, so one busy service doesn't
+	// starve the others
+	if !ok {
+		limits = l.Default
+		key.fallback = true
+		key.key = service
+		if !known {
+			key.key = request.URL.Host
+		}
+	}
+
+	if key.write {
+		return limits.Write, key
+	}
+	return limits.Read, key
+}
+
+// Wait blocks until the request to the service type fits into the budget and
+// returns the time it waited. It returns an error without waiting, when the
+// context deadline expires before a token is available.
+func (l *RateLimiter) Wait(ctx context.Context, request *http.Request, service string) (time.Duration, error) {
+	limit, key := l.limit(request, service)
+	if limit.Rate <= 0 {
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	if l.buckets == nil {
+		l.buckets = make(map[rateLimitKey]*tokenBucket)
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+	// the bucket is rebuilt, when the budget changes
+	b, ok := l.buckets[key]
+	if !ok || b.rate != limit.Rate || b.burst != burst {
+		b = &tokenBucket{
+			rate:   limit.Rate,
+			burst:  burst,
+			tokens: burst,
+			last:   time.Now(),
+		}
+		l.buckets[key] = b
+	}
+	delay := b.reserve(time.Now())
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		l.cancel(key)
+		return 0, fmt.Errorf("rate limit delay of %s exceeds the request deadline: %w", delay, context.DeadlineExceeded)
+	}
+
+	if err := sleepContext(ctx, delay); err != nil {
+		l.cancel(key)
+		return 0, err
+	}
+
+	return delay, nil
+}
+
+// cancel returns the reserved token back to the bucket.
+func (l *RateLimiter) cancel(key rateLimitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(b.burst, b.tokens+1)
+	}
+}
+
+// rateLimitError is returned, when the request is not sent because of the
+// rate limit.
+type rateLimitError struct {
+	method string
+	err    error
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("OpenStack %s request rate limited: %s", e.method, e.err)
+}
+
+func (e *rateLimitError) Unwrap() error {
+	return e.err
+}
+
+// rateLimit returns a step, which delays the requests exceeding the budget.
+func (rt *RoundTripper) rateLimit(l *RateLimiter, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		service, _ := rt.resolveService(request.URL)
+
+		delay, err := l.Wait(request.Context(), request, service)
+		if err != nil {
+			return nil, &rateLimitError{method: request.Method, err: err}
+		}
+		if delay > 0 && rt.Logger != nil {
+			rt.log().Printf("OpenStack %s request rate limited, waited %s", service, delay)
+		}
+
+		return next(request)
+	}
+}
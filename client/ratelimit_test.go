@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestRateLimiterBudgets(t *testing.T) {
+	l := &RateLimiter{
+		Limits: map[string]RateLimits{
+			"compute":             {Read: RateLimit{Rate: 1, Burst: 2}},
+			"volume.example.com":  {Write: RateLimit{Rate: 1}},
+			"network.example.com": {},
+			"":                    {Read: RateLimit{Rate: 5}},
+		},
+		Default: RateLimits{Read: RateLimit{Rate: 1}},
+	}
+
+	get, _ := http.NewRequest(http.MethodGet, "http://compute.example.com/servers", nil)
+	limit, key := l.limit(get, "compute")
+	th.AssertEquals(t, RateLimit{Rate: 1, Burst: 2}, limit)
+	th.AssertEquals(t, rateLimitKey{key: "compute"}, key)
+
+	post, _ := http.NewRequest(http.MethodPost, "http://volume.example.com:8776/volumes", nil)
+	limit, key = l.limit(post, "volume")
+	th.AssertEquals(t, RateLimit{Rate: 1}, limit)
+	th.AssertEquals(t, rateLimitKey{key: "volume.example.com", write: true}, key)
+
+	// an empty host budget disables the default one
+	get, _ = http.NewRequest(http.MethodGet, "http://network.example.com/v2.0/ports", nil)
+	limit, _ = l.limit(get, "network")
+	th.AssertEquals(t, RateLimit{}, limit)
+
+	get, _ = http.NewRequest(http.MethodGet, "http://image.example.com/v2/images", nil)
+	limit, key = l.limit(get, "image")
+	th.AssertEquals(t, RateLimit{Rate: 1}, limit)
+	th.AssertEquals(t, rateLimitKey{key: "image", fallback: true}, key)
+
+	// each service has its own default bucket, the unknown ones per host
+	get, _ = http.NewRequest(http.MethodGet, "http://dns.example.com/v2/zones", nil)
+	_, key = l.limit(get, "dns")
+	th.AssertEquals(t, rateLimitKey{key: "dns", fallback: true}, key)
+
+	get, _ = http.NewRequest(http.MethodGet, "http://example.com:8080/", nil)
+	limit, key = l.limit(get, "unknown")
+	th.AssertEquals(t, RateLimit{Rate: 1}, limit)
+	th.AssertEquals(t, rateLimitKey{key: "example.com:8080", fallback: true}, key)
+
+	// an unresolved service doesn't match the empty key
+	limit, key = l.limit(get, "")
+	th.AssertEquals(t, RateLimit{Rate: 1}, limit)
+	th.AssertEquals(t, rateLimitKey{key: "example.com:8080", fallback: true}, key)
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := &RateLimiter{
+		Default: RateLimits{
+			Read:  RateLimit{Rate: 20, Burst: 2},
+			Write: RateLimit{Rate: 1},
+		},
+	}
+
+	get, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	for i := 0; i < 2; i++ {
+		delay, err := l.Wait(context.Background(), get, "unknown")
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, time.Duration(0), delay)
+	}
+
+	delay, err := l.Wait(context.Background(), get, "unknown")
+	th.AssertNoErr(t, err)
+	if delay <= 0 || delay > 50*time.Millisecond {
+		t.Fatalf("unexpected delay: %s", delay)
+	}
+
+	// the mutating requests have a separate budget
+	post, _ := http.NewRequest(http.MethodPost, "http://example.com/", nil)
+	delay, err = l.Wait(context.Background(), post, "unknown")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, time.Duration(0), delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = l.Wait(ctx, post.WithContext(ctx), "unknown")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	// the token is returned back to the bucket
+	th.AssertEquals(t, true, l.buckets[rateLimitKey{key: "example.com", write: true, fallback: true}].tokens > -1)
+
+	// a busy service doesn't starve the others
+	other, _ := http.NewRequest(http.MethodGet, "http://other.example.com/", nil)
+	delay, err = l.Wait(context.Background(), other, "unknown")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, time.Duration(0), delay)
+
+	// a changed burst rebuilds the bucket
+	l.Default.Read.Burst = 5
+	for i := 0; i < 5; i++ {
+		delay, err := l.Wait(context.Background(), get, "unknown")
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, time.Duration(0), delay)
+	}
+}
+
+func TestRoundTripperRateLimiter(t *testing.T) {
+	rt := &RoundTripper{
+		Rt: staticTransport{status: http.StatusOK},
+		RateLimiter: &RateLimiter{
+			Limits: map[string]RateLimits{
+				"compute": {Read: RateLimit{Rate: 1}},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+
+	request, _ = http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:8774/v2.1/servers", nil)
+	_, err = rt.RoundTrip(request)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+
+	// other services are not limited
+	request, _ = http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:9696/v2.0/ports", nil)
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+}
@@ -0,0 +1,384 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecorderMode defines whether a Recorder records or replays interactions.
+type RecorderMode int
+
+const (
+	// RecorderModeRecord sends requests to the wrapped http.RoundTripper and
+	// records the interactions.
+	RecorderModeRecord RecorderMode = iota
+	// RecorderModeReplay replays the recorded interactions without sending
+	// any request.
+	RecorderModeReplay
+)
+
+// Cassette is a collection of recorded interactions, which is stored in a
+// file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest represents a recorded HTTP request with masked sensitive
+// headers and body fields.
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+	// Encoding is set to "base64", when the body is binary.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// RecordedResponse represents a recorded HTTP response with masked sensitive
+// headers and body fields.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Encoding is set to "base64", when the body is binary.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// ErrInteractionNotFound is returned in the replay mode, when no unused
+// recorded interaction matches the request.
+type ErrInteractionNotFound struct {
+	Method string
+	URL    string
+}
+
+func (e ErrInteractionNotFound) Error() string {
+	return fmt.Sprintf("no recorded interaction found for %s %s", e.Method, e.URL)
+}
+
+// Recorder is a http.RoundTripper, which records real OpenStack interactions
+// into a cassette file and replays them later. It is meant to be set as the
+// RoundTripper.Rt in order to run tests without a live cloud.
+//
+// Requests are matched on the method, path, query and the normalized body.
+// Each recorded interaction is replayed only once in the recorded order, so
+// the same request can return different responses, e.g. while polling a
+// resource status. Sensitive headers and JSON body fields are masked before
+// they are stored.
+type Recorder struct {
+	// Rt is the http.RoundTripper used to send requests in the record mode.
+	Rt http.RoundTripper
+	// Mode defines whether interactions are recorded or replayed. The
+	// cassette file is loaded on the first replay, unless interactions were
+	// recorded already.
+	Mode RecorderMode
+	// Path is the cassette file path.
+	Path string
+
+	// A pointer to a map of headers to be masked in the cassette
+	maskHeaders *map[string]struct{}
+	// A pointer to a set of JSON paths to be masked in the cassette
+	redactor *Redactor
+
+	mu       sync.Mutex
+	cassette Cassette
+	loaded   bool
+	used     []bool
+}
+
+// NewRecorder creates a new Recorder. In the replay mode the cassette file
+// is loaded immediately.
+func NewRecorder(path string, mode RecorderMode, rt http.RoundTripper) (*Recorder, error) {
+	r := &Recorder{
+		Rt:   rt,
+		Mode: mode,
+		Path: path,
+	}
+
+	if mode == RecorderModeReplay {
+		if err := r.prepareReplay(); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// prepareReplay loads the cassette file, unless there are recorded
+// interactions already, and marks the new interactions unused. The r.mu must
+// be locked, except in NewRecorder.
+func (r *Recorder) prepareReplay() error {
+	if !r.loaded && len(r.cassette.Interactions) == 0 {
+		content, err := os.ReadFile(r.Path)
+		if err != nil {
+			return fmt.Errorf("unable to read cassette: %w", err)
+		}
+		if err := json.Unmarshal(content, &r.cassette); err != nil {
+			return fmt.Errorf("unable to parse cassette: %w", err)
+		}
+	}
+	r.loaded = true
+
+	for len(r.used) < len(r.cassette.Interactions) {
+		r.used = append(r.used, false)
+	}
+
+	return nil
+}
+
+// SetSensitiveHeaders sets the list of case insensitive headers to be masked
+// in the cassette.
+func (r *Recorder) SetSensitiveHeaders(headers []string) {
+	newHeaders := make(map[string]struct{}, len(headers))
+
+	for _, h := range headers {
+		newHeaders[strings.ToLower(h)] = struct{}{}
+	}
+
+	// this is concurrency safe
+	r.maskHeaders = &newHeaders
+}
+
+// SetRedactionRules sets the list of JSON paths to be masked in the cassette.
+// See GetDefaultRedactionRules for the rules syntax.
+func (r *Recorder) SetRedactionRules(rules []string) {
+	// this is concurrency safe
+	r.redactor = NewRedactor(rules)
+}
+
+// Interactions returns a copy of the recorded or loaded interactions.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+// Save writes the recorded interactions into the cassette file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	content, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to marshal cassette: %w", err)
+	}
+
+	return os.WriteFile(r.Path, content, 0600)
+}
+
+// RoundTrip records or replays a single HTTP interaction.
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Mode == RecorderModeReplay {
+		return r.replay(request, reqBody)
+	}
+
+	// this is concurrency safe
+	ort := r.Rt
+	if ort == nil {
+		return nil, fmt.Errorf("Rt RoundTripper is nil, aborting")
+	}
+
+	response, err := ort.RoundTrip(request)
+	if err != nil {
+		return response, err
+	}
+
+	respBody, err := readResponseBody(response)
+	if err != nil {
+		return nil, err
+	}
+
+	body, encoding := r.scrubBody(reqBody)
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:   request.Method,
+			URL:      request.URL.String(),
+			Headers:  r.scrubHeaders(request.Header),
+			Body:     body,
+			Encoding: encoding,
+		},
+	}
+	body, encoding = r.scrubBody(respBody)
+	interaction.Response = RecordedResponse{
+		StatusCode: response.StatusCode,
+		Headers:    r.scrubHeaders(response.Header),
+		Body:       body,
+		Encoding:   encoding,
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return response, nil
+}
+
+func (r *Recorder) replay(request *http.Request, reqBody []byte) (*http.Response, error) {
+	body, _ := r.scrubBody(reqBody)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.prepareReplay(); err != nil {
+		return nil, err
+	}
+
+	for i, v := range r.cassette.Interactions {
+		if r.used[i] || !matchRequest(v.Request, request, body) {
+			continue
+		}
+		r.used[i] = true
+
+		respBody := []byte(v.Response.Body)
+		if v.Response.Encoding == "base64" {
+			var err error
+			respBody, err = base64.StdEncoding.DecodeString(v.Response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode recorded response body: %w", err)
+			}
+		}
+
+		headers := v.Response.Headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Del("Content-Length")
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", v.Response.StatusCode, http.StatusText(v.Response.StatusCode)),
+			StatusCode:    v.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        headers,
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       request,
+		}, nil
+	}
+
+	return nil, ErrInteractionNotFound{Method: request.Method, URL: request.URL.String()}
+}
+
+// matchRequest compares a recorded request with an actual one.
+func matchRequest(recorded RecordedRequest, request *http.Request, body string) bool {
+	if recorded.Method != request.Method {
+		return false
+	}
+
+	u, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	if u.Path != request.URL.Path {
+		return false
+	}
+	// Encode sorts the query by key
+	if u.Query().Encode() != request.URL.Query().Encode() {
+		return false
+	}
+
+	return recorded.Body == body
+}
+
+// scrubHeaders returns a copy of the headers with masked sensitive values.
+func (r *Recorder) scrubHeaders(headers http.Header) http.Header {
+	// this is concurrency safe
+	v := r.maskHeaders
+	if v == nil {
+		v = &defaultSensitiveHeaders
+	}
+	maskHeaders := *v
+
+	result := make(http.Header, len(headers))
+	for k, v := range headers {
+		if _, ok := maskHeaders[strings.ToLower(k)]; ok {
+			result[k] = []string{"***"}
+			continue
+		}
+		result[k] = append([]string(nil), v...)
+	}
+
+	return result
+}
+
+// scrubBody normalizes a JSON body and masks its sensitive fields. Binary
+// bodies are base64 encoded.
+func (r *Recorder) scrubBody(body []byte) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		// this is concurrency safe
+		redactor := r.redactor
+		if redactor == nil {
+			redactor = defaultRedactor
+		}
+		redactor.Redact(data)
+		// maps are marshalled with sorted keys
+		if normalized, err := json.Marshal(data); err == nil {
+			return string(normalized), ""
+		}
+	}
+
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// readRequestBody reads the request body and replaces it with an in-memory
+// copy.
+func readRequestBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	request.Body = newBufferedBody(body)
+
+	return body, nil
+}
+
+// readResponseBody reads the response body and replaces it with an in-memory
+// copy.
+func readResponseBody(response *http.Response) ([]byte, error) {
+	if response.Body == nil || response.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-Subject-Token", "secret-token")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"methods": ["password"], "call": %d}}`, calls)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	authBody := `{"auth": {"identity": {"methods": ["password"], "password": {"user": {"name": "jdoe", "password": "%s"}}}}}`
+
+	recorder, err := NewRecorder(path, RecorderModeRecord, http.DefaultTransport)
+	th.AssertNoErr(t, err)
+
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/auth/tokens?nocatalog=1&a=b", strings.NewReader(fmt.Sprintf(authBody, "password")))
+		request.Header.Set("Content-Type", "application/json")
+		response, err := recorder.RoundTrip(request)
+		th.AssertNoErr(t, err)
+		body, _ := io.ReadAll(response.Body)
+		th.AssertEquals(t, fmt.Sprintf(`{"token": {"methods": ["password"], "call": %d}}`, i+1), string(body))
+	}
+	th.AssertNoErr(t, recorder.Save())
+
+	interactions := recorder.Interactions()
+	th.AssertEquals(t, 2, len(interactions))
+	th.AssertEquals(t, `{"auth":{"identity":{"methods":["password"],"password":{"user":{"name":"jdoe","password":"***"}}}}}`, interactions[0].Request.Body)
+	th.AssertEquals(t, "***", interactions[0].Response.Headers.Get("X-Subject-Token"))
+
+	replayer, err := NewRecorder(path, RecorderModeReplay, nil)
+	th.AssertNoErr(t, err)
+
+	for i := 0; i < 2; i++ {
+		// the query order, the body formatting and the password don't matter
+		request, _ := http.NewRequest(http.MethodPost, "https://other.example.com/v3/auth/tokens?a=b&nocatalog=1", strings.NewReader(fmt.Sprintf(authBody, "other")))
+		response, err := replayer.RoundTrip(request)
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, http.StatusCreated, response.StatusCode)
+		body, _ := io.ReadAll(response.Body)
+		th.AssertEquals(t, fmt.Sprintf(`{"token":{"call":%d,"methods":["password"]}}`, i+1), string(body))
+	}
+
+	// all interactions were used
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/auth/tokens?a=b&nocatalog=1", strings.NewReader(fmt.Sprintf(authBody, "password")))
+	_, err = replayer.RoundTrip(request)
+	th.AssertEquals(t, true, errors.As(err, &ErrInteractionNotFound{}))
+	th.AssertEquals(t, 2, calls)
+
+	// the cassette is loaded on the first replay
+	literal := &Recorder{Mode: RecorderModeReplay, Path: path}
+	request, _ = http.NewRequest(http.MethodPost, server.URL+"/v3/auth/tokens?a=b&nocatalog=1", strings.NewReader(fmt.Sprintf(authBody, "password")))
+	response, err := literal.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusCreated, response.StatusCode)
+
+	// the recorded interactions are replayed after switching the mode
+	recorder.Mode = RecorderModeReplay
+	request, _ = http.NewRequest(http.MethodPost, server.URL+"/v3/auth/tokens?a=b&nocatalog=1", strings.NewReader(fmt.Sprintf(authBody, "password")))
+	response, err = recorder.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, http.StatusCreated, response.StatusCode)
+	th.AssertEquals(t, 2, calls)
+}
+
+func TestRecorderBinaryBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte{0xff, 0xfe, 0x00})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewRecorder(path, RecorderModeRecord, http.DefaultTransport)
+	th.AssertNoErr(t, err)
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/AUTH_test/container/object", nil)
+	_, err = recorder.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertNoErr(t, recorder.Save())
+	th.AssertEquals(t, "base64", recorder.Interactions()[0].Response.Encoding)
+
+	replayer, err := NewRecorder(path, RecorderModeReplay, nil)
+	th.AssertNoErr(t, err)
+	response, err := replayer.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	body, _ := io.ReadAll(response.Body)
+	th.AssertDeepEquals(t, []byte{0xff, 0xfe, 0x00}, body)
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// List of JSON paths that contain sensitive data.
+//
+// A path is a dot-separated list of object keys. The "*" element matches any
+// object key or any array element, "**" matches zero or more levels.
+var defaultRedactionRules = []string{
+	// Keystone v2 auth methods
+	"auth.passwordCredentials.password",
+	"auth.token.id",
+	// Keystone v3 auth methods
+	"auth.identity.password.user.password",
+	"auth.identity.application_credential.secret",
+	"auth.identity.token.id",
+	"auth.identity.totp.user.passcode",
+	// Keystone users, application and EC2 credentials
+	"user.password",
+	"user.original_password",
+	"application_credential.secret",
+	"credential.blob",
+	"credentials.*.blob",
+	"credentials.access",
+	"credentials.body_hash",
+	// Nova server admin password and keypairs
+	"server.adminPass",
+	"rebuild.adminPass",
+	"rescue.adminPass",
+	"evacuate.adminPass",
+	"changePassword.adminPass",
+	"keypair.private_key",
+	// Barbican secrets
+	"payload",
+	"secret.payload",
+	// Trove database users and root passwords
+	"password",
+	"users.*.password",
+	"instance.users.*.password",
+	"instance.root_password",
+	// Magnum cluster credentials
+	"pem",
+	"**.kubeconfig",
+}
+
+// GetDefaultRedactionRules returns the default list of JSON paths to be masked
+func GetDefaultRedactionRules() []string {
+	return append([]string(nil), defaultRedactionRules...)
+}
+
+// defaultRedactor is used, when no custom redaction rules were set.
+var defaultRedactor = NewRedactor(defaultRedactionRules)
+
+// Redactor masks JSON fields, which match path-based redaction rules.
+type Redactor struct {
+	rules [][]string
+}
+
+// NewRedactor creates a new Redactor with the given rules. See
+// GetDefaultRedactionRules for the rules syntax.
+func NewRedactor(rules []string) *Redactor {
+	r := &Redactor{
+		rules: make([][]string, 0, len(rules)),
+	}
+
+	for _, rule := range rules {
+		path := strings.Split(rule, ".")
+		// a rule which ends with "**" would mask the whole document
+		if rule == "" || path[len(path)-1] == "**" {
+			continue
+		}
+		r.rules = append(r.rules, path)
+	}
+
+	return r
+}
+
+// Redact masks the matching fields of an unmarshalled JSON document in place.
+func (r *Redactor) Redact(data interface{}) {
+	maskEC2Authorization(data)
+
+	for _, path := range r.rules {
+		redactPath(data, path)
+	}
+}
+
+// FormatJSON pretty-formats a JSON body and masks the matching fields.
+// It satisfies the RoundTripper.FormatJSON signature.
+func (r *Redactor) FormatJSON(raw []byte) (string, error) {
+	var rawData interface{}
+
+	err := json.Unmarshal(raw, &rawData)
+	if err != nil {
+		return string(raw), fmt.Errorf("unable to parse OpenStack JSON: %s", err)
+	}
+
+	r.Redact(rawData)
+
+	// Ignore the huge catalog output
+	if data, ok := rawData.(map[string]interface{}); ok {
+		if v, ok := data["token"].(map[string]interface{}); ok {
+			if _, ok := v["catalog"]; ok {
+				v["catalog"] = "***"
+			}
+		}
+	}
+
+	pretty, err := json.MarshalIndent(rawData, "", "  ")
+	if err != nil {
+		return string(raw), fmt.Errorf("unable to re-marshal OpenStack JSON: %s", err)
+	}
+
+	return string(pretty), nil
+}
+
+// SetRedactionRules sets the list of JSON paths to be masked in debug log.
+// See GetDefaultRedactionRules for the rules syntax. The rules are not
+// applied, when a custom FormatJSON function is set.
+func (rt *RoundTripper) SetRedactionRules(rules []string) {
+	// this is concurrency safe
+	rt.redactor = NewRedactor(rules)
+}
+
+func (rt *RoundTripper) getRedactor() *Redactor {
+	// this is concurrency safe
+	r := rt.redactor
+	if r == nil {
+		return defaultRedactor
+	}
+	return r
+}
+
+// redactPath masks the values matching the path.
+func redactPath(v interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	key, rest := path[0], path[1:]
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if key == "**" {
+			redactPath(t, rest)
+			for _, child := range t {
+				redactPath(child, path)
+			}
+			return
+		}
+		for k, child := range t {
+			if key != "*" && key != k {
+				continue
+			}
+			if len(rest) == 0 {
+				t[k] = "***"
+				continue
+			}
+			redactPath(child, rest)
+		}
+	case []interface{}:
+		if key == "**" {
+			redactPath(t, rest)
+			for _, child := range t {
+				redactPath(child, path)
+			}
+			return
+		}
+		for i, child := range t {
+			if key != "*" && key != strconv.Itoa(i) {
+				continue
+			}
+			if len(rest) == 0 {
+				t[i] = "***"
+				continue
+			}
+			redactPath(child, rest)
+		}
+	}
+}
+
+// maskEC2Authorization masks the EC2 access id in the signed Authorization
+// header of an EC2 credentials body.
+func maskEC2Authorization(data interface{}) {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if v, ok := m["credentials"].(map[string]interface{}); ok {
+		access, _ := v["access"].(string)
+		if access == "" || access == "***" {
+			return
+		}
+		if v, ok := v["headers"].(map[string]interface{}); ok {
+			if s, ok := v["Authorization"].(string); ok {
+				v["Authorization"] = strings.Replace(s, access, "***", -1)
+			}
+		}
+	}
+}
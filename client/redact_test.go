@@ -0,0 +1,92 @@
+package client
+
+import (
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestFormatJSONDefaultRules(t *testing.T) {
+	actual, err := FormatJSON([]byte(`{"server": {"id": "1", "adminPass": "secret"}}`))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{
+  "server": {
+    "adminPass": "***",
+    "id": "1"
+  }
+}`, actual)
+
+	actual, err = FormatJSON([]byte(`{"auth": {"identity": {"methods": ["password"], "password": {"user": {"name": "jdoe", "password": "secret"}}}}}`))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{
+  "auth": {
+    "identity": {
+      "methods": [
+        "password"
+      ],
+      "password": {
+        "user": {
+          "name": "jdoe",
+          "password": "***"
+        }
+      }
+    }
+  }
+}`, actual)
+
+	actual, err = FormatJSON([]byte(`{"credentials": {"access": "abc", "headers": {"Authorization": "AWS4-HMAC-SHA256 Credential=abc/20240101"}}}`))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{
+  "credentials": {
+    "access": "***",
+    "headers": {
+      "Authorization": "AWS4-HMAC-SHA256 Credential=***/20240101"
+    }
+  }
+}`, actual)
+}
+
+func TestRedactorWildcards(t *testing.T) {
+	r := NewRedactor([]string{"instance.users.*.password", "**.kubeconfig", "items.1", "**"})
+
+	actual, err := r.FormatJSON([]byte(`{"instance": {"users": [{"name": "a", "password": "x"}, {"name": "b", "password": "y"}]}, "cluster": {"nested": [{"kubeconfig": "z"}]}, "items": [1, 2, 3]}`))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{
+  "cluster": {
+    "nested": [
+      {
+        "kubeconfig": "***"
+      }
+    ]
+  },
+  "instance": {
+    "users": [
+      {
+        "name": "a",
+        "password": "***"
+      },
+      {
+        "name": "b",
+        "password": "***"
+      }
+    ]
+  },
+  "items": [
+    1,
+    "***",
+    3
+  ]
+}`, actual)
+}
+
+func TestRoundTripperRedactionRules(t *testing.T) {
+	rt := RoundTripper{}
+	rt.SetRedactionRules([]string{"foo"})
+
+	actual, err := rt.formatJSON()([]byte(`{"foo": "bar", "password": "baz"}`))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, `{
+  "foo": "***",
+  "password": "baz"
+}`, actual)
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+)
+
+type requestIDContextKey struct{}
+
+// requestIDHolder keeps the ID of the last request made with a context.
+type requestIDHolder struct {
+	mu sync.Mutex
+	id string
+}
+
+// WithRequestIDCapture returns a new context, which records the ID of the
+// last OpenStack request made with it. The ID can be retrieved with the
+// LastRequestID function.
+func WithRequestIDCapture(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, &requestIDHolder{})
+}
+
+// LastRequestID returns the ID of the last OpenStack request made with a
+// context returned by WithRequestIDCapture. It returns an empty string, when
+// no request was made or the service didn't return an ID.
+func LastRequestID(ctx context.Context) string {
+	h, ok := ctx.Value(requestIDContextKey{}).(*requestIDHolder)
+	if !ok {
+		return ""
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.id
+}
+
+// RequestIDFromError returns the OpenStack request ID of a failed request
+// from an error returned by the gophercloud calls. It returns an empty
+// string, when the error doesn't contain a response.
+func RequestIDFromError(err error) string {
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &respErr) {
+		return requestID(respErr.ResponseHeader)
+	}
+
+	var respErrPtr *gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &respErrPtr) && respErrPtr != nil {
+		return requestID(respErrPtr.ResponseHeader)
+	}
+
+	// the reauthentication errors don't support the unwrapping, gophercloud
+	// returns them as pointers
+	var reauthErrPtr *gophercloud.ErrErrorAfterReauthentication
+	if errors.As(err, &reauthErrPtr) && reauthErrPtr != nil {
+		return RequestIDFromError(reauthErrPtr.ErrOriginal)
+	}
+
+	var reauthErr gophercloud.ErrErrorAfterReauthentication
+	if errors.As(err, &reauthErr) {
+		return RequestIDFromError(reauthErr.ErrOriginal)
+	}
+
+	var unableErrPtr *gophercloud.ErrUnableToReauthenticate
+	if errors.As(err, &unableErrPtr) && unableErrPtr != nil {
+		return unableToReauthenticateRequestID(*unableErrPtr)
+	}
+
+	var unableErr gophercloud.ErrUnableToReauthenticate
+	if errors.As(err, &unableErr) {
+		return unableToReauthenticateRequestID(unableErr)
+	}
+
+	return ""
+}
+
+// unableToReauthenticateRequestID returns the request ID of the failed
+// reauthentication or of the original request.
+func unableToReauthenticateRequestID(err gophercloud.ErrUnableToReauthenticate) string {
+	if v := RequestIDFromError(err.ErrReauth); v != "" {
+		return v
+	}
+	return RequestIDFromError(err.ErrOriginal)
+}
+
+// captureRequestID returns a step, which records the request ID in the
+// request context created by WithRequestIDCapture.
+func (rt *RoundTripper) captureRequestID(next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		response, err := next(request)
+
+		if h, ok := request.Context().Value(requestIDContextKey{}).(*requestIDHolder); ok && response != nil {
+			h.mu.Lock()
+			h.id = requestID(response.Header)
+			h.mu.Unlock()
+		}
+
+		return response, err
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestRoundTripperCaptureRequestID(t *testing.T) {
+	rt := &RoundTripper{
+		Rt: staticTransport{
+			status:  http.StatusOK,
+			headers: http.Header{"X-Compute-Request-Id": {"req-123"}},
+		},
+	}
+
+	ctx := WithRequestIDCapture(context.Background())
+	th.AssertEquals(t, "", LastRequestID(ctx))
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "req-123", LastRequestID(ctx))
+
+	th.AssertEquals(t, "", LastRequestID(context.Background()))
+}
+
+func TestRequestIDFromError(t *testing.T) {
+	respErr := gophercloud.ErrUnexpectedResponseCode{
+		Actual:         http.StatusConflict,
+		ResponseHeader: http.Header{"X-Openstack-Request-Id": {"req-456"}},
+	}
+
+	th.AssertEquals(t, "req-456", RequestIDFromError(respErr))
+	th.AssertEquals(t, "req-456", RequestIDFromError(&respErr))
+	th.AssertEquals(t, "req-456", RequestIDFromError(fmt.Errorf("wrapped: %w", respErr)))
+	th.AssertEquals(t, "req-456", RequestIDFromError(gophercloud.ErrErrorAfterReauthentication{ErrOriginal: respErr}))
+
+	// gophercloud returns the reauthentication errors as pointers
+	afterReauthErr := &gophercloud.ErrErrorAfterReauthentication{}
+	afterReauthErr.ErrOriginal = &respErr
+	th.AssertEquals(t, "req-456", RequestIDFromError(afterReauthErr))
+	th.AssertEquals(t, "req-456", RequestIDFromError(fmt.Errorf("wrapped: %w", afterReauthErr)))
+
+	unableErr := &gophercloud.ErrUnableToReauthenticate{}
+	unableErr.ErrOriginal = &respErr
+	unableErr.ErrReauth = fmt.Errorf("connection refused")
+	th.AssertEquals(t, "req-456", RequestIDFromError(unableErr))
+
+	reauthErr := gophercloud.ErrUnexpectedResponseCode{
+		Actual:         http.StatusUnauthorized,
+		ResponseHeader: http.Header{"X-Openstack-Request-Id": {"req-reauth"}},
+	}
+	unableErr.ErrReauth = &reauthErr
+	th.AssertEquals(t, "req-reauth", RequestIDFromError(unableErr))
+	th.AssertEquals(t, "req-reauth", RequestIDFromError(*unableErr))
+	th.AssertEquals(t, "", RequestIDFromError(&url.Error{Op: "Get", URL: "http://example.com", Err: fmt.Errorf("connection refused")}))
+	th.AssertEquals(t, "", RequestIDFromError(nil))
+}
+
+func TestRetryBackoffFuncRequestID(t *testing.T) {
+	logger := &bufferLogger{}
+	respErr := &gophercloud.ErrUnexpectedResponseCode{
+		Actual: http.StatusTooManyRequests,
+		ResponseHeader: http.Header{
+			"Retry-After":            {"0"},
+			"X-Openstack-Request-Id": {"req-789"},
+		},
+	}
+
+	err := RetryBackoffFunc(logger)(context.Background(), respErr, respErr, 1)
+	th.AssertNoErr(t, err)
+	th.AssertDeepEquals(t, []string{"Received StatusTooManyRequests response code (request ID: req-789) sleeping for 0s"}, logger.lines)
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides whether and when a request, which didn't receive any
+// response from the server, should be sent again.
+type RetryPolicy interface {
+	// Backoff returns the delay to wait before the given retry attempt
+	// (starting at 1) and whether the request should be retried at all.
+	// elapsed is the time passed since the first attempt was made and err
+	// is the connection error returned by the last attempt.
+	Backoff(request *http.Request, retry int, elapsed time.Duration, err error) (time.Duration, bool)
+}
+
+// Default values used by ExponentialBackoff when the corresponding fields are
+// not set.
+const (
+	DefaultRetryInitialInterval = 500 * time.Millisecond
+	DefaultRetryMaxInterval     = 30 * time.Second
+	DefaultRetryMultiplier      = 2.0
+	DefaultRetryJitter          = 0.5
+)
+
+// ExponentialBackoff is a RetryPolicy, which increases the delay between
+// retries exponentially and randomizes it with a jitter in order to avoid
+// synchronized retries from many clients. By default only idempotent requests
+// are retried.
+type ExponentialBackoff struct {
+	// InitialInterval is the delay before the first retry.
+	// Defaults to DefaultRetryInitialInterval.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two retries.
+	// Defaults to DefaultRetryMaxInterval.
+	MaxInterval time.Duration
+	// Multiplier is the factor the delay is multiplied by on each retry.
+	// Defaults to DefaultRetryMultiplier.
+	Multiplier float64
+	// Jitter is the randomization factor in the [0, 1] range applied to each
+	// delay, e.g. 0.5 means the delay is a random value in the
+	// [0.5*delay, 1.5*delay] range. Defaults to DefaultRetryJitter, a
+	// negative value disables the jitter.
+	Jitter float64
+	// MaxElapsedTime is the time after which no more retries are made. Zero
+	// means no limit, so only RoundTripper.MaxRetries applies.
+	MaxElapsedTime time.Duration
+	// RetryNonIdempotent allows to retry requests with non-idempotent
+	// methods, e.g. POST or PATCH. Such requests may be applied twice by the
+	// server, when the connection was lost after the request was received.
+	RetryNonIdempotent bool
+}
+
+// Backoff satisfies the RetryPolicy interface.
+func (b *ExponentialBackoff) Backoff(request *http.Request, retry int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if !b.RetryNonIdempotent && !isIdempotent(request) {
+		return 0, false
+	}
+
+	sleep := exponentialDelay(b.InitialInterval, b.MaxInterval, b.Multiplier, b.Jitter, retry)
+
+	if b.MaxElapsedTime > 0 && elapsed+sleep > b.MaxElapsedTime {
+		return 0, false
+	}
+
+	return sleep, true
+}
+
+// exponentialDelay calculates the delay before the given retry attempt
+// (starting at 1). Zero values are replaced with the ExponentialBackoff
+// defaults and a negative jitter disables the randomization.
+func exponentialDelay(initial, max time.Duration, multiplier, jitter float64, retry int) time.Duration {
+	if initial <= 0 {
+		initial = DefaultRetryInitialInterval
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxInterval
+	}
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+	if jitter == 0 {
+		jitter = DefaultRetryJitter
+	}
+	if retry < 1 {
+		retry = 1
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay = delay - jitter*delay + rand.Float64()*2*jitter*delay
+	}
+
+	return time.Duration(delay)
+}
+
+// errBodyNotRewindable is returned, when a request body was already sent and
+// can't be read again.
+var errBodyNotRewindable = errors.New("request body can't be rewound, GetBody is not set")
+
+// defaultRetryPolicy is used, when RoundTripper.RetryPolicy is nil.
+var defaultRetryPolicy RetryPolicy = &ExponentialBackoff{}
+
+// isIdempotent reports whether the request can be safely sent twice. The
+// logic follows the net/http rules: idempotent methods and requests with an
+// Idempotency-Key header are considered idempotent.
+func isIdempotent(request *http.Request) bool {
+	if isIdempotentMethod(request.Method) {
+		return true
+	}
+
+	if _, ok := request.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := request.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+
+	return false
+}
+
+// isIdempotentMethod reports whether the HTTP method is idempotent.
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// rewindBody returns a fresh copy of the request body, so the request can be
+// sent again.
+func rewindBody(request *http.Request) error {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if request.GetBody == nil {
+		return errBodyNotRewindable
+	}
+
+	body, err := request.GetBody()
+	if err != nil {
+		return err
+	}
+	request.Body = body
+
+	return nil
+}
+
+// bufferedBody is an in-memory request body, which can be read again.
+type bufferedBody struct {
+	io.Reader
+	data []byte
+}
+
+func newBufferedBody(data []byte) *bufferedBody {
+	return &bufferedBody{bytes.NewReader(data), data}
+}
+
+// Close satisfies the io.Closer interface.
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// copy satisfies the http.Request.GetBody signature.
+func (b *bufferedBody) copy() (io.ReadCloser, error) {
+	return newBufferedBody(b.data), nil
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
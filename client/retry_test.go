@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+// flakyTransport fails the first failures requests with a connection error.
+type flakyTransport struct {
+	failures int
+	calls    int
+	bodies   []string
+}
+
+func (f *flakyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	f.calls++
+	if request.Body != nil {
+		b, err := io.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		f.bodies = append(f.bodies, string(b))
+	}
+	if f.calls <= f.failures {
+		return nil, fmt.Errorf("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Jitter:          -1,
+		MaxElapsedTime:  time.Minute,
+	}
+	get, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, v := range expected {
+		delay, ok := b.Backoff(get, i+1, 0, nil)
+		th.AssertEquals(t, true, ok)
+		th.AssertEquals(t, v, delay)
+	}
+
+	_, ok := b.Backoff(get, 1, time.Minute, nil)
+	th.AssertEquals(t, false, ok)
+
+	post, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	_, ok = b.Backoff(post, 1, 0, nil)
+	th.AssertEquals(t, false, ok)
+
+	post.Header.Set("Idempotency-Key", "123")
+	_, ok = b.Backoff(post, 1, 0, nil)
+	th.AssertEquals(t, true, ok)
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay, _ := b.Backoff(get, 1, 0, nil)
+		if delay < 500*time.Millisecond || delay > 1500*time.Millisecond {
+			t.Fatalf("delay %s is out of the jitter range", delay)
+		}
+	}
+}
+
+func TestRoundTripRetry(t *testing.T) {
+	ft := &flakyTransport{failures: 2}
+	rt := &RoundTripper{
+		Rt:          ft,
+		MaxRetries:  3,
+		RetryPolicy: &ExponentialBackoff{InitialInterval: time.Millisecond},
+	}
+
+	request, _ := http.NewRequest(http.MethodPut, "http://example.com", strings.NewReader(`{"foo":"bar"}`))
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 3, ft.calls)
+	th.AssertDeepEquals(t, []string{`{"foo":"bar"}`, `{"foo":"bar"}`, `{"foo":"bar"}`}, ft.bodies)
+
+	// the logged body is retried without modifying the request of the caller
+	ft = &flakyTransport{failures: 1}
+	rt.Rt = ft
+	rt.Logger = &bufferLogger{}
+	request, _ = http.NewRequest(http.MethodPut, "http://example.com", io.NopCloser(strings.NewReader(`{"foo":"bar"}`)))
+	request.Header.Set("Content-Type", "application/json")
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertDeepEquals(t, []string{`{"foo":"bar"}`, `{"foo":"bar"}`}, ft.bodies)
+	th.AssertEquals(t, true, request.GetBody == nil)
+}
+
+func TestRoundTripRetryNonIdempotent(t *testing.T) {
+	ft := &flakyTransport{failures: 1}
+	rt := &RoundTripper{
+		Rt:          ft,
+		MaxRetries:  3,
+		RetryPolicy: &ExponentialBackoff{InitialInterval: time.Millisecond},
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(`{}`))
+	_, err := rt.RoundTrip(request)
+	th.AssertErr(t, err)
+	th.AssertEquals(t, 1, ft.calls)
+
+	ft = &flakyTransport{failures: 1}
+	rt.Rt = ft
+	rt.RetryPolicy = &ExponentialBackoff{InitialInterval: time.Millisecond, RetryNonIdempotent: true}
+	request, _ = http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(`{}`))
+	_, err = rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, ft.calls)
+}
+
+func TestRoundTripRetryContextCanceled(t *testing.T) {
+	ft := &flakyTransport{failures: 5}
+	rt := &RoundTripper{
+		Rt:          ft,
+		MaxRetries:  5,
+		RetryPolicy: &ExponentialBackoff{InitialInterval: time.Hour},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertErr(t, err)
+	th.AssertEquals(t, 1, ft.calls)
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SlogLogger is an adapter, which satisfies the Logger interface and writes
+// the free text debug messages into a log/slog logger.
+type SlogLogger struct {
+	// Logger is the destination logger. slog.Default() is used, when nil.
+	Logger *slog.Logger
+	// Level is the level of the records. Defaults to slog.LevelDebug.
+	Level slog.Leveler
+}
+
+// Printf satisfies the Logger interface.
+func (l SlogLogger) Printf(format string, args ...interface{}) {
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelDebug
+	if l.Level != nil {
+		level = l.Level.Level()
+	}
+	logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+// logExchange returns a step, which performs a request and emits a single
+// structured record with the request and response details.
+func (rt *RoundTripper) logExchange(logger *slog.Logger, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		ctx := request.Context()
+		if !logger.Enabled(ctx, slog.LevelDebug) {
+			return next(request)
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", request.Method),
+			slog.String("url", request.URL.String()),
+			rt.headersAttr("request_headers", request.Header),
+		}
+
+		requestSize := request.ContentLength
+		if request.Body != nil {
+			text, size, body, err := rt.peekRequestBody(request.Body, request.Header.Get("Content-Type"), request.ContentLength, rt.compactJSON)
+			if err != nil {
+				return nil, err
+			}
+			request.Body, requestSize = body, size
+			if text != "" {
+				attrs = append(attrs, slog.String("request_body", text))
+			}
+		}
+		attrs = append(attrs, slog.Int64("request_size", requestSize))
+
+		start := time.Now()
+		response, err := next(request)
+		attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		if response != nil {
+			attrs = append(attrs,
+				slog.Int("status", response.StatusCode),
+				slog.String("request_id", requestID(response.Header)),
+				rt.headersAttr("response_headers", response.Header),
+			)
+
+			text, responseSize, body, e := rt.peekResponseBody(response.Body, response.Header.Get("Content-Type"), response.ContentLength, rt.compactJSON)
+			if e != nil {
+				return nil, e
+			}
+			response.Body = body
+			if text != "" {
+				attrs = append(attrs, slog.String("response_body", text))
+			}
+			attrs = append(attrs, slog.Int64("response_size", responseSize))
+		}
+
+		logger.LogAttrs(ctx, slog.LevelDebug, "OpenStack HTTP exchange", attrs...)
+
+		return response, err
+	}
+}
+
+// headersAttr converts the headers into a group attribute with masked
+// sensitive headers.
+func (rt *RoundTripper) headersAttr(name string, headers http.Header) slog.Attr {
+	maskHeaders := rt.sensitiveHeaders()
+
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		if _, ok := maskHeaders[strings.ToLower(k)]; ok {
+			attrs = append(attrs, slog.String(k, "***"))
+			continue
+		}
+		attrs = append(attrs, slog.String(k, strings.Join(headers[k], " ")))
+	}
+
+	return slog.Group(name, attrs...)
+}
+
+// compactJSON masks the JSON body and returns it in a compact form suitable
+// for a single log record.
+func (rt *RoundTripper) compactJSON(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	formatted, _ := rt.formatJSON()(body)
+
+	var bs bytes.Buffer
+	if err := json.Compact(&bs, []byte(formatted)); err != nil {
+		return formatted
+	}
+	return bs.String()
+}
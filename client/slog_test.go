@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+type staticTransport struct {
+	status  int
+	headers http.Header
+	body    string
+}
+
+func (s staticTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		io.Copy(io.Discard, request.Body)
+	}
+	return &http.Response{
+		StatusCode: s.status,
+		Header:     s.headers.Clone(),
+		Body:       io.NopCloser(strings.NewReader(s.body)),
+		Request:    request,
+	}, nil
+}
+
+func TestStructuredLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	rt := &RoundTripper{
+		Rt: staticTransport{
+			status: http.StatusAccepted,
+			headers: http.Header{
+				"Content-Type":           {"application/json"},
+				"X-Openstack-Request-Id": {"req-123"},
+			},
+			body: `{"server": {"id": "1", "adminPass": "secret"}}`,
+		},
+		StructuredLogger: logger,
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com/v2.1/servers", strings.NewReader(`{"server": {"name": "foo"}}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Auth-Token", "token")
+
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	body, _ := io.ReadAll(response.Body)
+	th.AssertEquals(t, `{"server": {"id": "1", "adminPass": "secret"}}`, string(body))
+
+	var record map[string]interface{}
+	th.AssertNoErr(t, json.Unmarshal(buf.Bytes(), &record))
+
+	th.AssertEquals(t, "OpenStack HTTP exchange", record["msg"])
+	th.AssertEquals(t, "POST", record["method"])
+	th.AssertEquals(t, "http://example.com/v2.1/servers", record["url"])
+	th.AssertEquals(t, float64(http.StatusAccepted), record["status"])
+	th.AssertEquals(t, "req-123", record["request_id"])
+	th.AssertEquals(t, float64(27), record["request_size"])
+	th.AssertEquals(t, float64(46), record["response_size"])
+	th.AssertEquals(t, `{"server":{"name":"foo"}}`, record["request_body"])
+	th.AssertEquals(t, `{"server":{"adminPass":"***","id":"1"}}`, record["response_body"])
+	th.AssertEquals(t, "***", record["request_headers"].(map[string]interface{})["X-Auth-Token"])
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogLogger{
+		Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	logger.Printf("OpenStack Response Code: %d", 200)
+	th.AssertEquals(t, true, strings.Contains(buf.String(), `level=DEBUG msg="OpenStack Response Code: 200"`))
+}
+
+func TestStructuredLoggerLargeBody(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	image := &countingReader{}
+	transport := &flakyTransport{}
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			if _, err := transport.RoundTrip(request); err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+				Body:          image,
+				ContentLength: 1 << 40,
+				Request:       request,
+			}, nil
+		}),
+		StructuredLogger: logger,
+		LogMaxBodySize:   16,
+	}
+
+	payload := `{"server": {"name": "foo", "adminPass": "secret"}}`
+	request, _ := http.NewRequest(http.MethodPost, "http://example.com:8774/v2.1/servers", strings.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	response, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, payload, transport.bodies[0])
+
+	// the binary body is not read
+	th.AssertEquals(t, int64(0), image.read)
+	th.AssertEquals(t, io.ReadCloser(image), response.Body)
+
+	var record map[string]interface{}
+	th.AssertNoErr(t, json.Unmarshal(buf.Bytes(), &record))
+	th.AssertEquals(t, "<JSON body larger than 16 bytes is not logged>", record["request_body"])
+	th.AssertEquals(t, float64(len(payload)), record["request_size"])
+	th.AssertEquals(t, "<binary application/octet-stream body of 1099511627776 bytes>", record["response_body"])
+	th.AssertEquals(t, float64(1<<40), record["response_size"])
+}
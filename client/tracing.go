@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer is a minimal tracing interface, which can be implemented on top of
+// any tracing library, e.g. OpenTelemetry.
+type Tracer interface {
+	// StartSpan starts a new span as a child of the span in the context, if
+	// any, and returns a context containing the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// SpanContext returns the span identifiers used for the propagation.
+	SpanContext() SpanContext
+	// SetAttribute sets a span attribute.
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed.
+	RecordError(err error)
+	// End finishes the span.
+	End()
+}
+
+// SpanContext holds the W3C Trace Context identifiers of a span.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent returns the W3C traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value.
+func ParseTraceParent(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent: %q", v)
+	}
+	// only the version 00 is known, which has exactly four parts
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent: %q", v)
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent trace ID: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid traceparent span ID: %w", err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid traceparent flags: %w", err)
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent: %q", v)
+	}
+
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a new context containing the span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span stored in the context or nil.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanContextKey{}).(Span)
+	return span
+}
+
+// NoopTracer is a Tracer, which doesn't record anything.
+type NoopTracer struct{}
+
+// StartSpan satisfies the Tracer interface.
+func (NoopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext                   { return SpanContext{} }
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
+
+// InMemoryTracer is a Tracer, which keeps the finished spans in memory. It
+// is meant to be used in tests.
+type InMemoryTracer struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// StartSpan satisfies the Tracer interface.
+func (t *InMemoryTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span := &RecordedSpan{
+		Name:       name,
+		Attributes: make(map[string]interface{}),
+		StartTime:  time.Now(),
+		tracer:     t,
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil && parent.SpanContext().IsValid() {
+		span.Parent = parent.SpanContext()
+		span.Context.TraceID = span.Parent.TraceID
+		span.Context.Sampled = span.Parent.Sampled
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = true
+	}
+	rand.Read(span.Context.SpanID[:])
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans returns the finished spans.
+func (t *InMemoryTracer) Spans() []*RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*RecordedSpan(nil), t.spans...)
+}
+
+// Reset removes all the finished spans.
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
+
+// RecordedSpan is a Span recorded by the InMemoryTracer.
+type RecordedSpan struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]interface{}
+	Err        error
+	StartTime  time.Time
+	EndTime    time.Time
+
+	mu     sync.Mutex
+	tracer *InMemoryTracer
+}
+
+// SpanContext satisfies the Span interface.
+func (s *RecordedSpan) SpanContext() SpanContext {
+	return s.Context
+}
+
+// SetAttribute satisfies the Span interface.
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// RecordError satisfies the Span interface.
+func (s *RecordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Err = err
+}
+
+// End satisfies the Span interface.
+func (s *RecordedSpan) End() {
+	s.mu.Lock()
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// trace returns a step, which wraps each request into a span and propagates
+// it to the OpenStack services with the W3C traceparent header.
+func (rt *RoundTripper) trace(tracer Tracer, next roundTripFunc) roundTripFunc {
+	return func(request *http.Request) (*http.Response, error) {
+		service, path := rt.resolveService(request.URL)
+		ctx, span := tracer.StartSpan(request.Context(), request.Method+" "+pathTemplate(service, path))
+		defer span.End()
+
+		span.SetAttribute("http.request.method", request.Method)
+		span.SetAttribute("url.full", request.URL.String())
+		span.SetAttribute("server.address", request.URL.Hostname())
+		span.SetAttribute("openstack.service.type", service)
+
+		// the original request must not be modified
+		request = request.Clone(ctx)
+		if sc := span.SpanContext(); sc.IsValid() {
+			request.Header.Set("Traceparent", sc.TraceParent())
+		}
+
+		response, err := next(request)
+		if err != nil {
+			span.RecordError(err)
+		}
+		if response != nil {
+			span.SetAttribute("http.response.status_code", response.StatusCode)
+			if v := requestID(response.Header); v != "" {
+				span.SetAttribute("openstack.request_id", v)
+			}
+			if response.StatusCode >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("unexpected status code %d", response.StatusCode))
+			}
+		}
+
+		return response, err
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, sc.Sampled)
+	th.AssertEquals(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceParent(v)
+		th.AssertErr(t, err)
+	}
+}
+
+func TestRoundTripperTracer(t *testing.T) {
+	tracer := &InMemoryTracer{}
+
+	var traceParent string
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			traceParent = request.Header.Get("Traceparent")
+			return staticTransport{
+				status:  http.StatusNotFound,
+				headers: http.Header{"X-Openstack-Request-Id": {"req-123"}},
+			}.RoundTrip(request)
+		}),
+		Tracer: tracer,
+	}
+
+	ctx, parent := tracer.StartSpan(context.Background(), "parent")
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com:8774/v2.1/servers/5f3b9c6e-8a3f-4a5e-9d8a-1a2b3c4d5e6f", nil)
+
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	parent.End()
+
+	spans := tracer.Spans()
+	th.AssertEquals(t, 2, len(spans))
+
+	span := spans[0]
+	th.AssertEquals(t, "GET /v2.1/servers/{id}", span.Name)
+	th.AssertEquals(t, parent.SpanContext(), span.Parent)
+	th.AssertEquals(t, parent.SpanContext().TraceID, span.Context.TraceID)
+	th.AssertEquals(t, span.Context.TraceParent(), traceParent)
+	// the caller's request is not modified
+	th.AssertEquals(t, "", request.Header.Get("Traceparent"))
+	th.AssertEquals(t, "compute", span.Attributes["openstack.service.type"])
+	th.AssertEquals(t, "req-123", span.Attributes["openstack.request_id"])
+	th.AssertEquals(t, http.StatusNotFound, span.Attributes["http.response.status_code"])
+	th.AssertEquals(t, nil, span.Err)
+}
+
+func TestRoundTripperNoopTracer(t *testing.T) {
+	var traceParent string
+	rt := &RoundTripper{
+		Rt: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			traceParent = request.Header.Get("Traceparent")
+			return staticTransport{status: http.StatusOK}.RoundTrip(request)
+		}),
+		Tracer: NoopTracer{},
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	_, err := rt.RoundTrip(request)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "", traceParent)
+}
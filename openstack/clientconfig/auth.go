@@ -0,0 +1,316 @@
+package clientconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/env"
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	"github.com/vnpaycloud-console/gophercloud/v2/openstack"
+)
+
+// isStandaloneAuth determines if the auth type is used by a service deployed
+// without Keystone.
+func isStandaloneAuth(authType AuthType) bool {
+	return authType == AuthNoAuth || authType == AuthHTTPBasic
+}
+
+// isOIDCAuth determines if the auth type uses the OpenID Connect federation.
+func isOIDCAuth(authType AuthType) bool {
+	switch authType {
+	case AuthV3OIDCPassword, AuthV3OIDCClientCredentials, AuthV3OIDCAccessToken:
+		return true
+	}
+	return false
+}
+
+// multiFactorMethods returns the methods of the v3totp and v3multifactor auth
+// types.
+func multiFactorMethods(cloud *Cloud) (map[string]struct{}, error) {
+	if cloud.AuthType == AuthV3TOTP {
+		return map[string]struct{}{"totp": {}}, nil
+	}
+
+	authMethods := cloud.AuthInfo.AuthMethods
+	if len(authMethods) == 0 {
+		authMethods = []string{"v3password", "v3totp"}
+	}
+
+	methods := make(map[string]struct{}, len(authMethods))
+	for _, v := range authMethods {
+		switch method := strings.TrimSpace(v); method {
+		case "v3password", "password":
+			methods["password"] = struct{}{}
+		case "v3totp", "totp":
+			methods["totp"] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unsupported auth method %q, must be v3password or v3totp", method)
+		}
+	}
+
+	return methods, nil
+}
+
+// standaloneAuth creates a gophercloud.AuthOptions struct for a service
+// deployed without Keystone. Only the credentials of the http_basic auth type
+// are set.
+func standaloneAuth(cloud *Cloud, opts *ClientOpts) (*gophercloud.AuthOptions, error) {
+	// Environment variable overrides.
+	envPrefix := "OS_"
+	if opts != nil && opts.EnvPrefix != "" {
+		envPrefix = opts.EnvPrefix
+	}
+
+	if cloud.AuthInfo.Endpoint == "" {
+		if v := env.Getenv(envPrefix + "ENDPOINT"); v != "" {
+			cloud.AuthInfo.Endpoint = v
+		}
+	}
+
+	if cloud.AuthInfo.Username == "" {
+		if v := env.Getenv(envPrefix + "USERNAME"); v != "" {
+			cloud.AuthInfo.Username = v
+		}
+	}
+
+	if cloud.AuthInfo.Password == "" {
+		if v := env.Getenv(envPrefix + "PASSWORD"); v != "" {
+			cloud.AuthInfo.Password = v
+		}
+	}
+
+	// Check for absolute minimum requirements.
+	if cloud.AuthInfo.Endpoint == "" {
+		return nil, gophercloud.ErrMissingInput{Argument: "endpoint"}
+	}
+
+	ao := new(gophercloud.AuthOptions)
+	if cloud.AuthType == AuthHTTPBasic {
+		if cloud.AuthInfo.Username == "" {
+			return nil, gophercloud.ErrMissingInput{Argument: "username"}
+		}
+		ao.Username = cloud.AuthInfo.Username
+		ao.Password = cloud.AuthInfo.Password
+	}
+
+	return ao, nil
+}
+
+// newProvider returns an unauthenticated provider client for the cloud entry
+// resolved by authOptions.
+func newProvider(cloud *Cloud, ao *gophercloud.AuthOptions) (*gophercloud.ProviderClient, error) {
+	if isStandaloneAuth(cloud.AuthType) {
+		pClient := new(gophercloud.ProviderClient)
+		pClient.UseTokenLock()
+		return pClient, nil
+	}
+
+	return openstack.NewClient(ao.IdentityEndpoint)
+}
+
+// authenticate authenticates the provider client with the auth type of the
+// cloud entry resolved by authOptions.
+func authenticate(ctx context.Context, pClient *gophercloud.ProviderClient, cloud *Cloud, ao *gophercloud.AuthOptions) error {
+	switch {
+	case isStandaloneAuth(cloud.AuthType):
+		// Every service is located at the endpoint.
+		endpoint := gophercloud.NormalizeURL(cloud.AuthInfo.Endpoint)
+		pClient.EndpointLocator = func(gophercloud.EndpointOpts) (string, error) {
+			return endpoint, nil
+		}
+
+		if cloud.AuthType == AuthHTTPBasic {
+			transport := pClient.HTTPClient.Transport
+			if transport == nil {
+				transport = http.DefaultTransport
+			}
+			pClient.HTTPClient.Transport = &basicAuthTransport{
+				rt:       transport,
+				username: ao.Username,
+				password: ao.Password,
+			}
+		}
+
+		return nil
+	case isOIDCAuth(cloud.AuthType):
+		return authenticateOIDC(ctx, pClient, cloud.AuthType, *cloud.AuthInfo, *ao)
+	}
+
+	return openstack.Authenticate(ctx, pClient, *ao)
+}
+
+// authenticateOIDC obtains an access token from the identity provider,
+// exchanges it for an unscoped Keystone token and scopes the token.
+func authenticateOIDC(ctx context.Context, pClient *gophercloud.ProviderClient, authType AuthType, authInfo AuthInfo, ao gophercloud.AuthOptions) error {
+	if authInfo.IdentityProvider == "" {
+		return gophercloud.ErrMissingInput{Argument: "identity_provider"}
+	}
+	if authInfo.Protocol == "" {
+		return gophercloud.ErrMissingInput{Argument: "protocol"}
+	}
+
+	accessToken, err := oidcAccessToken(ctx, pClient, authType, authInfo)
+	if err != nil {
+		return err
+	}
+
+	tokenID, err := federatedToken(ctx, pClient, authInfo, accessToken)
+	if err != nil {
+		return err
+	}
+
+	// Gophercloud can't reauthenticate with the federation, so the
+	// reauthentication is set up below.
+	allowReauth := ao.AllowReauth
+	ao.TokenID = tokenID
+	ao.AllowReauth = false
+	if err := openstack.Authenticate(ctx, pClient, ao); err != nil {
+		return err
+	}
+
+	if allowReauth {
+		reauth, err := throwawayReauth(pClient, func(ctx context.Context, tac *gophercloud.ProviderClient) error {
+			return authenticateOIDC(ctx, tac, authType, authInfo, ao)
+		})
+		if err != nil {
+			return err
+		}
+		pClient.ReauthFunc = reauth
+	}
+
+	return nil
+}
+
+// throwawayReauth returns a ReauthFunc, which authenticates a throw-away copy
+// of the provider client and copies its token into the provider client, the
+// same as Gophercloud does.
+func throwawayReauth(pClient *gophercloud.ProviderClient, authenticate func(context.Context, *gophercloud.ProviderClient) error) (func(context.Context) error, error) {
+	tac := *pClient
+	tac.SetThrowaway(true)
+	tac.ReauthFunc = nil
+	if err := tac.SetTokenAndAuthResult(nil); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		if err := authenticate(ctx, &tac); err != nil {
+			return err
+		}
+		pClient.CopyTokenFrom(&tac)
+		return nil
+	}, nil
+}
+
+// oidcAccessToken returns the access token of the OpenID Connect auth type.
+// The token is requested from the token endpoint of the identity provider,
+// unless the v3oidcaccesstoken auth type is used.
+func oidcAccessToken(ctx context.Context, pClient *gophercloud.ProviderClient, authType AuthType, authInfo AuthInfo) (string, error) {
+	if authType == AuthV3OIDCAccessToken {
+		if authInfo.AccessToken == "" {
+			return "", gophercloud.ErrMissingInput{Argument: "access_token"}
+		}
+		return authInfo.AccessToken, nil
+	}
+
+	tokenEndpoint := authInfo.AccessTokenEndpoint
+	if tokenEndpoint == "" {
+		if authInfo.DiscoveryEndpoint == "" {
+			return "", gophercloud.ErrMissingInput{Argument: "access_token_endpoint"}
+		}
+
+		var discovery struct {
+			TokenEndpoint string `json:"token_endpoint"`
+		}
+		_, err := pClient.Request(ctx, "GET", authInfo.DiscoveryEndpoint, &gophercloud.RequestOpts{
+			JSONResponse: &discovery,
+			OkCodes:      []int{200},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to discover the access token endpoint: %w", err)
+		}
+		if discovery.TokenEndpoint == "" {
+			return "", fmt.Errorf("no token_endpoint found in %s", authInfo.DiscoveryEndpoint)
+		}
+		tokenEndpoint = discovery.TokenEndpoint
+	}
+
+	form := url.Values{}
+	form.Set("scope", defaultIfEmpty(authInfo.OpenIDScope, "openid"))
+	switch authType {
+	case AuthV3OIDCPassword:
+		form.Set("grant_type", "password")
+		form.Set("username", authInfo.Username)
+		form.Set("password", authInfo.Password)
+	case AuthV3OIDCClientCredentials:
+		form.Set("grant_type", "client_credentials")
+	}
+
+	// The client authenticates with the HTTP basic authentication.
+	clientAuth := base64.StdEncoding.EncodeToString([]byte(authInfo.ClientID + ":" + authInfo.ClientSecret))
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	_, err := pClient.Request(ctx, "POST", tokenEndpoint, &gophercloud.RequestOpts{
+		RawBody: strings.NewReader(form.Encode()),
+		MoreHeaders: map[string]string{
+			"Authorization": "Basic " + clientAuth,
+			"Content-Type":  "application/x-www-form-urlencoded",
+		},
+		JSONResponse: &token,
+		OkCodes:      []int{200},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain an access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access_token found in the response of %s", tokenEndpoint)
+	}
+
+	return token.AccessToken, nil
+}
+
+// federatedToken exchanges the access token for an unscoped Keystone token.
+func federatedToken(ctx context.Context, pClient *gophercloud.ProviderClient, authInfo AuthInfo, accessToken string) (string, error) {
+	identityEndpoint := pClient.IdentityEndpoint
+	if !strings.HasSuffix(identityEndpoint, "/v3/") {
+		identityEndpoint = pClient.IdentityBase + "v3/"
+	}
+
+	federationURL := fmt.Sprintf("%sOS-FEDERATION/identity_providers/%s/protocols/%s/auth",
+		identityEndpoint, url.PathEscape(authInfo.IdentityProvider), url.PathEscape(authInfo.Protocol))
+	resp, err := pClient.Request(ctx, "POST", federationURL, &gophercloud.RequestOpts{
+		MoreHeaders: map[string]string{
+			"Authorization": "Bearer " + accessToken,
+		},
+		OkCodes: []int{200, 201},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange the access token: %w", err)
+	}
+
+	tokenID := resp.Header.Get("X-Subject-Token")
+	if tokenID == "" {
+		return "", fmt.Errorf("no X-Subject-Token header found in the response of %s", federationURL)
+	}
+
+	return tokenID, nil
+}
+
+// basicAuthTransport sets the HTTP basic authentication of the http_basic auth
+// type.
+type basicAuthTransport struct {
+	rt       http.RoundTripper
+	username string
+	password string
+}
+
+func (t *basicAuthTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.SetBasicAuth(t.username, t.password)
+	return t.rt.RoundTrip(request)
+}
@@ -0,0 +1,399 @@
+package clientconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// CloudsFile is an editable clouds.yaml file together with its secure.yaml
+// file. The edits are applied to the YAML nodes, so the comments, the key
+// order and the quoting of the untouched values are preserved.
+//
+// The secrets of the cloud entries, i.e. the password, the passcode, the
+// token, the application credential secret and the OpenID Connect client
+// secret and access token, are written into the secure.yaml file.
+type CloudsFile struct {
+	// Path is the clouds.yaml file.
+	Path string
+	// SecurePath is the secure.yaml file.
+	SecurePath string
+
+	doc         *yaml.Node
+	secureDoc   *yaml.Node
+	secureDirty bool
+}
+
+// LoadCloudsFile reads a clouds.yaml file and its secure.yaml file for
+// editing. The files, which do not exist yet, are created on Save. When the
+// securePath is empty, the secure.yaml next to the clouds.yaml is used.
+func LoadCloudsFile(path, securePath string) (*CloudsFile, error) {
+	if securePath == "" {
+		securePath = filepath.Join(filepath.Dir(path), "secure.yaml")
+	}
+
+	f := &CloudsFile{
+		Path:       path,
+		SecurePath: securePath,
+	}
+
+	var err error
+	f.doc, err = readYAMLDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	f.secureDoc, err = readYAMLDocument(securePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Names returns the names of the cloud entries in the file order.
+func (f *CloudsFile) Names() []string {
+	clouds := cloudsNode(f.doc, false)
+	if clouds == nil {
+		return nil
+	}
+
+	var names []string
+	for i := 0; i+1 < len(clouds.Content); i += 2 {
+		names = append(names, clouds.Content[i].Value)
+	}
+	return names
+}
+
+// Get returns the cloud entry merged with its secrets.
+func (f *CloudsFile) Get(name string) (*Cloud, error) {
+	node := mappingValue(cloudsNode(f.doc, false), name)
+	if node == nil {
+		return nil, fmt.Errorf("cloud %s does not exist in %s", name, f.Path)
+	}
+
+	var cloud Cloud
+	if err := node.Decode(&cloud); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+
+	if secureNode := mappingValue(cloudsNode(f.secureDoc, false), name); secureNode != nil {
+		var secureCloud Cloud
+		if err := secureNode.Decode(&secureCloud); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+		}
+		return mergeClouds(secureCloud, cloud)
+	}
+
+	return &cloud, nil
+}
+
+// Add adds a new cloud entry.
+func (f *CloudsFile) Add(name string, cloud Cloud) error {
+	if mappingValue(cloudsNode(f.doc, false), name) != nil {
+		return fmt.Errorf("cloud %s already exists in %s", name, f.Path)
+	}
+	return f.set(name, cloud)
+}
+
+// Update replaces the cloud entry. The comments of the kept keys are
+// preserved.
+func (f *CloudsFile) Update(name string, cloud Cloud) error {
+	if mappingValue(cloudsNode(f.doc, false), name) == nil {
+		return fmt.Errorf("cloud %s does not exist in %s", name, f.Path)
+	}
+	return f.set(name, cloud)
+}
+
+// Rename renames the cloud entry.
+func (f *CloudsFile) Rename(oldName, newName string) error {
+	clouds := cloudsNode(f.doc, false)
+	i := mappingIndex(clouds, oldName)
+	if i < 0 {
+		return fmt.Errorf("cloud %s does not exist in %s", oldName, f.Path)
+	}
+	if mappingIndex(clouds, newName) >= 0 {
+		return fmt.Errorf("cloud %s already exists in %s", newName, f.Path)
+	}
+	clouds.Content[i].Value = newName
+
+	if secureClouds := cloudsNode(f.secureDoc, false); secureClouds != nil {
+		if mappingIndex(secureClouds, oldName) >= 0 {
+			// a stale entry would be merged into the renamed one
+			removeMappingKey(secureClouds, newName)
+			secureClouds.Content[mappingIndex(secureClouds, oldName)].Value = newName
+			f.secureDirty = true
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the cloud entry together with its secrets.
+func (f *CloudsFile) Delete(name string) error {
+	if !removeMappingKey(cloudsNode(f.doc, false), name) {
+		return fmt.Errorf("cloud %s does not exist in %s", name, f.Path)
+	}
+	if removeMappingKey(cloudsNode(f.secureDoc, false), name) {
+		f.secureDirty = true
+	}
+	return nil
+}
+
+// Save writes the clouds.yaml file and, when the secrets were changed, the
+// secure.yaml file. The secure.yaml file is written with the 0600
+// permissions.
+func (f *CloudsFile) Save() error {
+	if err := writeYAMLDocument(f.Path, f.doc, 0644); err != nil {
+		return err
+	}
+	if f.secureDirty {
+		if err := writeYAMLDocument(f.SecurePath, f.secureDoc, 0600); err != nil {
+			return err
+		}
+		f.secureDirty = false
+	}
+	return nil
+}
+
+// set writes the cloud entry into the clouds.yaml and its secrets into the
+// secure.yaml.
+func (f *CloudsFile) set(name string, cloud Cloud) error {
+	public, secrets := splitSecrets(cloud)
+
+	if err := setMappingValue(cloudsNode(f.doc, true), name, public); err != nil {
+		return err
+	}
+
+	if secrets != nil {
+		f.secureDirty = true
+		return setMappingValue(cloudsNode(f.secureDoc, true), name, *secrets)
+	}
+	if removeMappingKey(cloudsNode(f.secureDoc, false), name) {
+		f.secureDirty = true
+	}
+	return nil
+}
+
+// splitSecrets returns the cloud without the secrets and a cloud with only
+// the secrets, which is nil, when the cloud has no secrets.
+func splitSecrets(cloud Cloud) (Cloud, *Cloud) {
+	if cloud.AuthInfo == nil {
+		return cloud, nil
+	}
+
+	auth := *cloud.AuthInfo
+	secrets := AuthInfo{
+		Password:                    auth.Password,
+		Passcode:                    auth.Passcode,
+		Token:                       auth.Token,
+		ApplicationCredentialSecret: auth.ApplicationCredentialSecret,
+		ClientSecret:                auth.ClientSecret,
+		AccessToken:                 auth.AccessToken,
+	}
+	if reflect.DeepEqual(secrets, AuthInfo{}) {
+		return cloud, nil
+	}
+
+	auth.Password = ""
+	auth.Passcode = ""
+	auth.Token = ""
+	auth.ApplicationCredentialSecret = ""
+	auth.ClientSecret = ""
+	auth.AccessToken = ""
+	cloud.AuthInfo = &auth
+
+	return cloud, &Cloud{AuthInfo: &secrets}
+}
+
+func readYAMLDocument(path string) (*yaml.Node, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &yaml.Node{Kind: yaml.DocumentNode}, nil
+		}
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+	if doc.Kind == 0 {
+		// an empty file
+		doc.Kind = yaml.DocumentNode
+	}
+	return &doc, nil
+}
+
+func writeYAMLDocument(path string, doc *yaml.Node, perm os.FileMode) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+
+	// keep the permissions of an existing file
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	// write into a temporary file first, so the file is never left
+	// truncated, when the process is interrupted
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// cloudsNode returns the "clouds" mapping of the document. When create is
+// true, the missing mapping is created.
+func cloudsNode(doc *yaml.Node, create bool) *yaml.Node {
+	if doc == nil || doc.Kind != yaml.DocumentNode {
+		return nil
+	}
+
+	if len(doc.Content) == 0 {
+		if !create {
+			return nil
+		}
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	clouds := mappingValue(root, "clouds")
+	if clouds == nil || clouds.Kind != yaml.MappingNode {
+		if !create {
+			return nil
+		}
+		removeMappingKey(root, "clouds")
+		clouds = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "clouds"}, clouds)
+	}
+	// an empty mapping would be written inline
+	clouds.Style &^= yaml.FlowStyle
+
+	return clouds
+}
+
+// mappingIndex returns the index of the key node in the mapping or -1.
+func mappingIndex(mapping *yaml.Node, key string) int {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+func removeMappingKey(mapping *yaml.Node, key string) bool {
+	i := mappingIndex(mapping, key)
+	if i < 0 {
+		return false
+	}
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return true
+}
+
+// setMappingValue sets the value of the key to the encoded value. An existing
+// value is updated in place.
+func setMappingValue(mapping *yaml.Node, key string, value interface{}) error {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to marshal yaml: %w", err)
+	}
+
+	if existing := mappingValue(mapping, key); existing != nil {
+		syncNode(existing, &node)
+		return nil
+	}
+
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &node)
+	return nil
+}
+
+// syncNode updates the dst node to match the src node. The existing mapping
+// keys keep their order and comments, the new keys are appended and the
+// missing keys are removed.
+func syncNode(dst, src *yaml.Node) {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		content := make([]*yaml.Node, 0, len(src.Content))
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			if v := mappingValue(src, dst.Content[i].Value); v != nil {
+				syncNode(dst.Content[i+1], v)
+				content = append(content, dst.Content[i], dst.Content[i+1])
+			}
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			if mappingIndex(dst, src.Content[i].Value) < 0 {
+				content = append(content, src.Content[i], src.Content[i+1])
+			}
+		}
+		dst.Content = content
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		for i := range src.Content {
+			if i < len(dst.Content) {
+				syncNode(dst.Content[i], src.Content[i])
+			}
+		}
+		if len(dst.Content) > len(src.Content) {
+			dst.Content = dst.Content[:len(src.Content)]
+		} else {
+			dst.Content = append(dst.Content, src.Content[len(dst.Content):]...)
+		}
+	case dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode:
+		// an unchanged value keeps its tag, e.g. a numeric api version
+		// marshalled as a string
+		if dst.Value == src.Value {
+			return
+		}
+		// a quoted style would change the type of the value
+		if dst.ShortTag() != src.ShortTag() {
+			dst.Style = src.Style
+		}
+		dst.Tag = src.Tag
+		dst.Value = src.Value
+	default:
+		head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+	}
+}
@@ -42,5 +42,230 @@ Example to Create a Service Client from clouds.yaml
 	if err != nil {
 		panic(err)
 	}
+
+Example to Create a Service Client for Each Region from clouds.yaml
+
+	opts := &clientconfig.ClientOpts{
+		Cloud: "hawaii",
+	}
+
+	computeClients, err := clientconfig.NewServiceClients(ctx, "compute", opts)
+	if err != nil {
+		panic(err)
+	}
+
+	results, err := clientconfig.ForEachRegion(ctx, computeClients, 4, func(ctx context.Context, region string, client *gophercloud.ServiceClient) (interface{}, error) {
+		return servers.List(client, nil).AllPages(ctx)
+	})
+
+	var regionErrors clientconfig.RegionErrors
+	if errors.As(err, &regionErrors) {
+		for region, err := range regionErrors {
+			log.Printf("Failed to list the servers in %s: %v", region, err)
+		}
+	}
+
+The per-region values of the cloud entry are applied, and the regions sharing
+the same authentication settings are authenticated only once.
+
+Example to Limit the Request Rate from clouds.yaml
+
+	clouds:
+	  hawaii:
+	    rate_limits:
+	      default:
+	        read: 20
+	        write: 5
+	      compute:
+	        read: 10
+	        read_burst: 20
+	        write: 2
+
+The limits are applied by NewServiceClient on top of the HTTP client
+transport. NewRateLimiter can be used to apply them to other provider clients:
+
+	cloud, err := clientconfig.GetCloudFromYAML(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	pClient.HTTPClient = http.Client{
+		Transport: &client.RoundTripper{
+			Rt:          &http.Transport{},
+			RateLimiter: clientconfig.NewRateLimiter(cloud.RateLimits),
+		},
+	}
+
+Example to Edit a clouds.yaml File
+
+	f, err := clientconfig.LoadCloudsFile(os.ExpandEnv("$HOME/.config/openstack/clouds.yaml"), "")
+	if err != nil {
+		panic(err)
+	}
+
+	err = f.Add("jdoe-dev", clientconfig.Cloud{
+		RegionName: "RegionOne",
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:           "https://keystone.example.com:5000/v3",
+			Username:          "jdoe",
+			Password:          "secret",
+			ProjectName:       "jdoe-dev",
+			ProjectDomainName: "Default",
+			UserDomainName:    "Default",
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	if err := f.Save(); err != nil {
+		panic(err)
+	}
+
+The comments and the order of the other entries are preserved. The password
+is written into the secure.yaml file next to the clouds.yaml file.
+
+Example to Validate a clouds.yaml File
+
+	diagnostics, err := clientconfig.Validator{}.ValidateFile("clouds.yaml")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, d := range diagnostics {
+		// clouds.yaml:14:7: warning: cloud production: unknown key auth.usrname
+		fmt.Println(d)
+	}
+
+Example to Deny Dangerous Requests from clouds.yaml
+
+	clouds:
+	  production:
+	    policy:
+	      deny:
+	        - methods: ["DELETE"]
+	          services: ["compute", "volumev3"]
+	        - methods: ["POST"]
+	          path: "/servers/[^/]+/action$"
+	          reason: "no server actions in production"
+	  audit:
+	    policy:
+	      read_only: true
+
+The policy is enforced by NewServiceClient and AuthenticatedClient. The
+denied requests are not sent and fail with a client.ErrPolicyDenied error. The
+rules with services also deny the requests to the endpoints missing in the
+service catalog.
+
+Example to Authenticate with OpenID Connect from clouds.yaml
+
+	clouds:
+	  sso:
+	    auth_type: v3oidcpassword
+	    auth:
+	      auth_url: "https://keystone.example.com:5000/v3"
+	      identity_provider: "myidp"
+	      protocol: "openid"
+	      discovery_endpoint: "https://idp.example.com/.well-known/openid-configuration"
+	      client_id: "openstack"
+	      client_secret: "secret"
+	      username: "jdoe"
+	      password: "password"
+	      project_id: "12345"
+
+The v3oidcclientcredentials auth type omits the username and the password,
+the v3oidcaccesstoken auth type sets the access_token instead. The same
+settings are read from the OS_IDENTITY_PROVIDER, OS_PROTOCOL,
+OS_DISCOVERY_ENDPOINT, OS_ACCESS_TOKEN_ENDPOINT, OS_CLIENT_ID,
+OS_CLIENT_SECRET, OS_OPENID_SCOPE and OS_ACCESS_TOKEN environment variables.
+
+Example to Create a Service Client for a Standalone Ironic
+
+	opts := &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthHTTPBasic,
+		AuthInfo: &clientconfig.AuthInfo{
+			Endpoint: "https://ironic.example.com:6385",
+			Username: "ironic",
+			Password: "secret",
+		},
+	}
+
+	client, err := clientconfig.NewServiceClient(context.TODO(), "baremetal", opts)
+	if err != nil {
+		panic(err)
+	}
+
+The noauth auth type sends the requests to the endpoint without any
+credentials.
+
+Example to Reuse the Tokens Between Processes
+
+	opts := &clientconfig.ClientOpts{
+		Cloud:      "hawaii",
+		TokenCache: &clientconfig.TokenCache{},
+	}
+
+	client, err := clientconfig.NewServiceClient(context.TODO(), "compute", opts)
+	if err != nil {
+		panic(err)
+	}
+
+The token and the service catalog are cached in ~/.cache/openstack/tokens
+until shortly before the token expires, so the subsequent processes don't
+request a new token from Keystone.
+
+Example to Keep the Secrets out of clouds.yaml
+
+	clouds:
+	  production:
+	    auth:
+	      auth_url: "https://keystone.example.com:5000/v3"
+	      username: "jdoe"
+	      password_command: "pass show openstack/production"
+	  ci:
+	    auth_type: v3applicationcredential
+	    auth:
+	      auth_url: "https://keystone.example.com:5000/v3"
+	      application_credential_id: "app-cred-id"
+	      application_credential_secret: "env:CI_APP_CRED_SECRET"
+
+The secrets may refer to an environment variable with "env:VAR" or to a file
+with "file:PATH". A secret starting with a scheme is written with the
+"literal:" prefix, e.g. "literal:file:abc" is the "file:abc" password. Other
+secret stores are supported by registering a SecretResolver for their scheme:
+
+	clientconfig.RegisterSecretResolver("vault", clientconfig.SecretResolverFunc(func(ref string) (string, error) {
+		return readFromVault(ref)
+	}))
+
+The secrets are resolved by AuthOptions, after the environment variables are
+applied. The provider clients resolve them only when they request a token, so
+e.g. the password_command doesn't run, when the token cache has the token.
+
+Example to Override the Endpoints and API Versions of the Services
+
+	clouds:
+	  hawaii:
+	    auth:
+	      auth_url: "https://keystone.example.com:5000/v3"
+	      ...
+	    region_name: "RegionOne"
+	    compute_api_version: "2.79"
+	    object_store_endpoint_override: "https://swift.example.com/v1/AUTH_12345"
+	    block_storage_region_name: "RegionTwo"
+	    load_balancer_interface: "internal"
+
+The per-service keys take precedence over the region and the interface of the
+cloud entry for their service only, and are available as Cloud.Services:
+
+	cloud, err := clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{Cloud: "hawaii"})
+	if err != nil {
+		panic(err)
+	}
+
+	endpoint := cloud.Service("object-store").EndpointOverride
+
+The minor API version is sent as the microversion by NewServiceClient, e.g.
+compute requests use the 2.79 microversion.
 */
 package clientconfig
@@ -0,0 +1,257 @@
+package clientconfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/env"
+	"github.com/vnpaycloud-console/gophercloud/v2"
+)
+
+// RegionErrors maps the region names to the errors of the regions, which
+// failed.
+type RegionErrors map[string]error
+
+func (e RegionErrors) regions() []string {
+	regions := make([]string, 0, len(e))
+	for k := range e {
+		regions = append(regions, k)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+func (e RegionErrors) Error() string {
+	var s []string
+	for _, region := range e.regions() {
+		s = append(s, fmt.Sprintf("region %s: %s", region, e[region]))
+	}
+	return strings.Join(s, "; ")
+}
+
+// Unwrap returns the errors of the regions, so they can be inspected with
+// errors.Is and errors.As.
+func (e RegionErrors) Unwrap() []error {
+	var errs []error
+	for _, region := range e.regions() {
+		errs = append(errs, e[region])
+	}
+	return errs
+}
+
+// providerKey identifies the provider clients, which can be shared between
+// the regions.
+type providerKey struct {
+	authType       AuthType
+	authInfo       AuthInfo
+	authOptions    gophercloud.AuthOptions
+	caCertFile     string
+	clientCertFile string
+	clientKeyFile  string
+	verify         *bool
+}
+
+// loadedCloudYAMLOpts serves a cloud entry, which is merged with its profile
+// and with secure.yaml already.
+type loadedCloudYAMLOpts struct {
+	name  string
+	cloud Cloud
+}
+
+func (opts loadedCloudYAMLOpts) LoadCloudsYAML() (map[string]Cloud, error) {
+	cloud := opts.cloud
+	// the profile is merged already
+	cloud.Profile = ""
+	cloud.Cloud = ""
+	return map[string]Cloud{opts.name: cloud}, nil
+}
+
+func (opts loadedCloudYAMLOpts) LoadSecureCloudsYAML() (map[string]Cloud, error) {
+	return nil, nil
+}
+
+func (opts loadedCloudYAMLOpts) LoadPublicCloudsYAML() (map[string]Cloud, error) {
+	return nil, nil
+}
+
+// NewServiceClients is a convenience function to get a service client for
+// each region of a clouds.yaml entry, or for the given regions only. The
+// per-region values of the cloud entry are applied to each region. The
+// regions sharing the same authentication settings share a single
+// authenticated provider client.
+//
+// The regions, which failed, are missing in the result and reported with a
+// RegionErrors error.
+func NewServiceClients(ctx context.Context, service string, opts *ClientOpts, regions ...string) (map[string]*gophercloud.ServiceClient, error) {
+	// If no opts were passed in, create an empty ClientOpts.
+	if opts == nil {
+		opts = new(ClientOpts)
+	}
+
+	envPrefix := "OS_"
+	if opts.EnvPrefix != "" {
+		envPrefix = opts.EnvPrefix
+	}
+
+	cloudName := opts.Cloud
+	if cloudName == "" {
+		cloudName = env.Getenv(envPrefix + "CLOUD")
+	}
+
+	// Load the cloud entry without the per-region values.
+	cloudOpts := *opts
+	cloudOpts.RegionName = ""
+	cloud, err := GetCloudFromYAML(&cloudOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The regions merge their values into the loaded cloud entry, so the
+	// YAML files are not loaded again for each region.
+	cloudOpts.Cloud = cloudName
+	cloudOpts.YAMLOpts = loadedCloudYAMLOpts{name: cloudName, cloud: *cloud}
+
+	if len(regions) == 0 {
+		for _, v := range cloud.Regions {
+			regions = append(regions, v.Name)
+		}
+	}
+
+	// A cloud entry without the regions list has a single region.
+	if len(regions) == 0 {
+		region := env.Getenv(envPrefix + "REGION_NAME")
+		if v := cloud.RegionName; v != "" {
+			region = v
+		}
+		if v := opts.RegionName; v != "" {
+			region = v
+		}
+		regions = []string{region}
+	}
+
+	type provider struct {
+		key    providerKey
+		client *gophercloud.ProviderClient
+	}
+	var providers []provider
+
+	clients := make(map[string]*gophercloud.ServiceClient, len(regions))
+	errs := make(RegionErrors)
+	for _, region := range regions {
+		regionOpts := cloudOpts
+		regionOpts.RegionName = region
+
+		regionCloud, err := GetCloudFromYAML(&regionOpts)
+		if err != nil {
+			errs[region] = err
+			continue
+		}
+
+		authCloud, ao, err := authOptions(&regionOpts)
+		if err != nil {
+			errs[region] = err
+			continue
+		}
+
+		key := providerKey{
+			authType:       authCloud.AuthType,
+			authInfo:       *authCloud.AuthInfo,
+			authOptions:    *ao,
+			caCertFile:     regionCloud.CACertFile,
+			clientCertFile: regionCloud.ClientCertFile,
+			clientKeyFile:  regionCloud.ClientKeyFile,
+			verify:         regionCloud.Verify,
+		}
+
+		var pClient *gophercloud.ProviderClient
+		for _, p := range providers {
+			if reflect.DeepEqual(p.key, key) {
+				pClient = p.client
+				break
+			}
+		}
+		if pClient == nil {
+			pClient, err = newProviderClient(ctx, regionCloud, cloudName, envPrefix, &regionOpts)
+			if err != nil {
+				errs[region] = err
+				continue
+			}
+			providers = append(providers, provider{key: key, client: pClient})
+		}
+
+		client, err := newServiceClient(pClient, service, regionCloud, envPrefix, &regionOpts)
+		if err != nil {
+			errs[region] = err
+			continue
+		}
+		clients[region] = client
+	}
+
+	if len(errs) > 0 {
+		return clients, errs
+	}
+
+	return clients, nil
+}
+
+// RegionFunc is called by ForEachRegion with the service client of a region.
+type RegionFunc func(ctx context.Context, region string, client *gophercloud.ServiceClient) (interface{}, error)
+
+// ForEachRegion calls the function concurrently for each of the regional
+// service clients, e.g. returned by NewServiceClients, and collects the
+// results by region. At most concurrency functions run at once, zero means
+// no limit.
+//
+// The regions, which failed, are missing in the results and reported with a
+// RegionErrors error. The failure of a region does not cancel the others.
+func ForEachRegion(ctx context.Context, clients map[string]*gophercloud.ServiceClient, concurrency int, fn RegionFunc) (map[string]interface{}, error) {
+	if concurrency <= 0 || concurrency > len(clients) {
+		concurrency = len(clients)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]interface{}, len(clients))
+		errs    = make(RegionErrors)
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for region, client := range clients {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			errs[region] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(region string, client *gophercloud.ServiceClient) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := fn(ctx, region, client)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[region] = err
+				return
+			}
+			results[region] = result
+		}(region, client)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return results, errs
+	}
+
+	return results, nil
+}
@@ -7,13 +7,17 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
 
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
 	"github.com/vnpaycloud-console/gophercloud-utils/v2/env"
 	"github.com/vnpaycloud-console/gophercloud-utils/v2/gnocchi"
 	"github.com/vnpaycloud-console/gophercloud-utils/v2/internal"
 	"github.com/vnpaycloud-console/gophercloud/v2"
 	"github.com/vnpaycloud-console/gophercloud/v2/openstack"
+	tokens2 "github.com/vnpaycloud-console/gophercloud/v2/openstack/identity/v2/tokens"
+	"github.com/vnpaycloud-console/gophercloud/v2/openstack/identity/v3/tokens"
 
 	"github.com/gofrs/uuid/v5"
 
@@ -41,6 +45,29 @@ const (
 
 	// AuthV3ApplicationCredential defines version 3 of the application credential
 	AuthV3ApplicationCredential AuthType = "v3applicationcredential"
+
+	// AuthV3OIDCPassword defines version 3 of the OpenID Connect federation
+	// with an access token obtained by the resource owner password grant
+	AuthV3OIDCPassword AuthType = "v3oidcpassword"
+	// AuthV3OIDCClientCredentials defines version 3 of the OpenID Connect
+	// federation with an access token obtained by the client credentials grant
+	AuthV3OIDCClientCredentials AuthType = "v3oidcclientcredentials"
+	// AuthV3OIDCAccessToken defines version 3 of the OpenID Connect federation
+	// with a pre-obtained access token
+	AuthV3OIDCAccessToken AuthType = "v3oidcaccesstoken"
+
+	// AuthV3TOTP defines version 3 of the time-based one-time password
+	AuthV3TOTP AuthType = "v3totp"
+	// AuthV3MultiFactor defines version 3 of the password combined with the
+	// time-based one-time password
+	AuthV3MultiFactor AuthType = "v3multifactor"
+
+	// AuthNoAuth defines a service deployed without Keystone, which requires
+	// no authentication
+	AuthNoAuth AuthType = "noauth"
+	// AuthHTTPBasic defines a service deployed without Keystone, which
+	// requires the HTTP basic authentication
+	AuthHTTPBasic AuthType = "http_basic"
 )
 
 // ClientOpts represents options to customize the way a client is
@@ -52,8 +79,8 @@ type ClientOpts struct {
 	// EnvPrefix allows a custom environment variable prefix to be used.
 	EnvPrefix string
 
-	// AuthType specifies the type of authentication to use.
-	// By default, this is "password".
+	// AuthType specifies the type of authentication to use, when the cloud
+	// entry does not set one. By default, this is "password".
 	AuthType AuthType
 
 	// AuthInfo defines the authentication information needed to
@@ -80,6 +107,11 @@ type ClientOpts struct {
 	// is to call the local LoadCloudsYAML functions defined
 	// in this file.
 	YAMLOpts YAMLOptsBuilder
+
+	// TokenCache provides the ability to reuse the tokens issued to the
+	// other processes. This is optional and the default behavior is to
+	// request a new token.
+	TokenCache *TokenCache
 }
 
 // YAMLOptsBuilder defines an interface for customization when
@@ -252,6 +284,14 @@ func GetCloudFromYAML(opts *ClientOpts) (*Cloud, error) {
 				return nil, fmt.Errorf("cloud %s does not exist in clouds-public.yaml", profileName)
 			}
 
+			// A profile must not run commands, only clouds.yaml and
+			// secure.yaml may set the password_command.
+			if publicCloud.AuthInfo != nil && publicCloud.AuthInfo.PasswordCommand != "" {
+				authInfo := *publicCloud.AuthInfo
+				authInfo.PasswordCommand = ""
+				publicCloud.AuthInfo = &authInfo
+			}
+
 			cloud, err = mergeClouds(cloud, publicCloud)
 			if err != nil {
 				return nil, fmt.Errorf("Could not merge information from clouds.yaml and clouds-public.yaml for cloud %s", profileName)
@@ -344,6 +384,19 @@ func GetCloudFromYAML(opts *ClientOpts) (*Cloud, error) {
 // See http://docs.openstack.org/developer/os-client-config and
 // https://github.com/openstack/os-client-config/blob/master/os_client_config/config.py.
 func AuthOptions(opts *ClientOpts) (*gophercloud.AuthOptions, error) {
+	cloud, _, err := authOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	_, ao, err := resolveAuthOptions(cloud, opts)
+	return ao, err
+}
+
+// authOptions returns the cloud entry with the auth settings resolved from
+// the environment variables along with the AuthOptions built from it. The
+// secret references, the password_file and the password_command are not
+// resolved yet, see resolveAuthOptions.
+func authOptions(opts *ClientOpts) (*Cloud, *gophercloud.AuthOptions, error) {
 	cloud := new(Cloud)
 
 	// If no opts were passed in, create an empty ClientOpts.
@@ -376,7 +429,7 @@ func AuthOptions(opts *ClientOpts) (*gophercloud.AuthOptions, error) {
 		var err error
 		cloud, err = GetCloudFromYAML(opts)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
@@ -394,6 +447,58 @@ func AuthOptions(opts *ClientOpts) (*gophercloud.AuthOptions, error) {
 		}
 	}
 
+	// The auth type of the cloud entry takes precedence over the ClientOpts
+	// and the environment variables.
+	envPrefix := "OS_"
+	if opts.EnvPrefix != "" {
+		envPrefix = opts.EnvPrefix
+	}
+
+	if cloud.AuthType == "" {
+		cloud.AuthType = opts.AuthType
+	}
+
+	if cloud.AuthType == "" {
+		cloud.AuthType = AuthType(env.Getenv(envPrefix + "AUTH_TYPE"))
+	}
+
+	ao, err := buildAuthOptions(cloud, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cloud, ao, nil
+}
+
+// resolveAuthOptions resolves the secrets of a copy of the cloud entry
+// returned by authOptions and builds the AuthOptions from it again. The
+// environment variables, which may set the secrets, are already merged into
+// the cloud entry.
+func resolveAuthOptions(cloud *Cloud, opts *ClientOpts) (*Cloud, *gophercloud.AuthOptions, error) {
+	resolved := *cloud
+	authInfo := *cloud.AuthInfo
+	resolved.AuthInfo = &authInfo
+
+	if err := resolveSecrets(resolved.AuthInfo); err != nil {
+		return nil, nil, err
+	}
+
+	ao, err := buildAuthOptions(&resolved, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &resolved, ao, nil
+}
+
+// buildAuthOptions builds the AuthOptions of the auth type and the Identity
+// API version of the cloud entry.
+func buildAuthOptions(cloud *Cloud, opts *ClientOpts) (*gophercloud.AuthOptions, error) {
+	// The services deployed without Keystone don't use the Identity API.
+	if isStandaloneAuth(cloud.AuthType) {
+		return standaloneAuth(cloud, opts)
+	}
+
 	identityAPI := determineIdentityAPI(cloud, opts)
 	switch identityAPI {
 	case "2.0", "2":
@@ -444,6 +549,10 @@ func determineIdentityAPI(cloud *Cloud, opts *ClientOpts) string {
 			identityAPI = "3"
 		case AuthV3ApplicationCredential:
 			identityAPI = "3"
+		case AuthV3OIDCPassword, AuthV3OIDCClientCredentials, AuthV3OIDCAccessToken:
+			identityAPI = "3"
+		case AuthV3TOTP, AuthV3MultiFactor:
+			identityAPI = "3"
 		}
 	}
 
@@ -653,6 +762,66 @@ func v3auth(cloud *Cloud, opts *ClientOpts) (*gophercloud.AuthOptions, error) {
 		}
 	}
 
+	if cloud.AuthInfo.Passcode == "" {
+		if v := env.Getenv(envPrefix + "PASSCODE"); v != "" {
+			cloud.AuthInfo.Passcode = v
+		}
+	}
+
+	if len(cloud.AuthInfo.AuthMethods) == 0 {
+		if v := env.Getenv(envPrefix + "AUTH_METHODS"); v != "" {
+			cloud.AuthInfo.AuthMethods = strings.Split(v, ",")
+		}
+	}
+
+	if cloud.AuthInfo.IdentityProvider == "" {
+		if v := env.Getenv(envPrefix + "IDENTITY_PROVIDER"); v != "" {
+			cloud.AuthInfo.IdentityProvider = v
+		}
+	}
+
+	if cloud.AuthInfo.Protocol == "" {
+		if v := env.Getenv(envPrefix + "PROTOCOL"); v != "" {
+			cloud.AuthInfo.Protocol = v
+		}
+	}
+
+	if cloud.AuthInfo.ClientID == "" {
+		if v := env.Getenv(envPrefix + "CLIENT_ID"); v != "" {
+			cloud.AuthInfo.ClientID = v
+		}
+	}
+
+	if cloud.AuthInfo.ClientSecret == "" {
+		if v := env.Getenv(envPrefix + "CLIENT_SECRET"); v != "" {
+			cloud.AuthInfo.ClientSecret = v
+		}
+	}
+
+	if cloud.AuthInfo.DiscoveryEndpoint == "" {
+		if v := env.Getenv(envPrefix + "DISCOVERY_ENDPOINT"); v != "" {
+			cloud.AuthInfo.DiscoveryEndpoint = v
+		}
+	}
+
+	if cloud.AuthInfo.AccessTokenEndpoint == "" {
+		if v := env.Getenv(envPrefix + "ACCESS_TOKEN_ENDPOINT"); v != "" {
+			cloud.AuthInfo.AccessTokenEndpoint = v
+		}
+	}
+
+	if cloud.AuthInfo.OpenIDScope == "" {
+		if v := env.Getenv(envPrefix + "OPENID_SCOPE"); v != "" {
+			cloud.AuthInfo.OpenIDScope = v
+		}
+	}
+
+	if cloud.AuthInfo.AccessToken == "" {
+		if v := env.Getenv(envPrefix + "ACCESS_TOKEN"); v != "" {
+			cloud.AuthInfo.AccessToken = v
+		}
+	}
+
 	// Build a scope and try to do it correctly.
 	// https://github.com/openstack/os-client-config/blob/master/os_client_config/config.py#L595
 	scope := new(gophercloud.AuthScope)
@@ -704,17 +873,50 @@ func v3auth(cloud *Cloud, opts *ClientOpts) (*gophercloud.AuthOptions, error) {
 		AllowReauth:                 cloud.AuthInfo.AllowReauth,
 	}
 
-	// If an auth_type of "token" was specified, then make sure
-	// Gophercloud properly authenticates with a token. This involves
-	// unsetting a few other auth options. The reason this is done
-	// here is to wait until all auth settings (both in clouds.yaml
-	// and via environment variables) are set and then unset them.
-	if strings.Contains(string(cloud.AuthType), "token") || ao.TokenID != "" {
+	// Make sure Gophercloud properly authenticates with the auth_type.
+	// This involves unsetting the auth options, which the auth_type
+	// doesn't use. The reason this is done here is to wait until all auth
+	// settings (both in clouds.yaml and via environment variables) are set
+	// and then unset them.
+	switch cloud.AuthType {
+	case AuthV3OIDCPassword, AuthV3OIDCClientCredentials, AuthV3OIDCAccessToken:
+		// The user authenticates to the identity provider, which issues
+		// the access token exchanged for an unscoped Keystone token. See
+		// authenticateOIDC.
+		ao.TokenID = ""
 		ao.Username = ""
 		ao.Password = ""
 		ao.UserID = ""
 		ao.DomainID = ""
 		ao.DomainName = ""
+		ao.ApplicationCredentialID = ""
+		ao.ApplicationCredentialName = ""
+		ao.ApplicationCredentialSecret = ""
+	case AuthV3TOTP, AuthV3MultiFactor:
+		methods, err := multiFactorMethods(cloud)
+		if err != nil {
+			return nil, err
+		}
+		ao.TokenID = ""
+		if _, ok := methods["password"]; !ok {
+			ao.Password = ""
+		}
+		if _, ok := methods["totp"]; ok {
+			if cloud.AuthInfo.Passcode == "" {
+				return nil, gophercloud.ErrMissingInput{Argument: "passcode"}
+			}
+			ao.Passcode = cloud.AuthInfo.Passcode
+		}
+	default:
+		// If an auth_type of "token" was specified, then make sure
+		// Gophercloud properly authenticates with a token.
+		if strings.Contains(string(cloud.AuthType), "token") || ao.TokenID != "" {
+			ao.Username = ""
+			ao.Password = ""
+			ao.UserID = ""
+			ao.DomainID = ""
+			ao.DomainName = ""
+		}
 	}
 
 	// Check for absolute minimum requirements.
@@ -729,12 +931,172 @@ func v3auth(cloud *Cloud, opts *ClientOpts) (*gophercloud.AuthOptions, error) {
 // AuthenticatedClient is a convenience function to get a new provider client
 // based on a clouds.yaml entry.
 func AuthenticatedClient(ctx context.Context, opts *ClientOpts) (*gophercloud.ProviderClient, error) {
-	ao, err := AuthOptions(opts)
+	// If no opts were passed in, create an empty ClientOpts.
+	if opts == nil {
+		opts = new(ClientOpts)
+	}
+
+	envPrefix := "OS_"
+	if opts.EnvPrefix != "" {
+		envPrefix = opts.EnvPrefix
+	}
+
+	cloudName := opts.Cloud
+	if cloudName == "" {
+		cloudName = env.Getenv(envPrefix + "CLOUD")
+	}
+
+	cloud, ao, err := authOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return openstack.AuthenticatedClient(ctx, *ao)
+	pClient, err := newProvider(cloud, ao)
+	if err != nil {
+		return nil, err
+	}
+
+	region := regionName(cloud, envPrefix, opts)
+	err = authenticateWithCache(ctx, pClient, opts.TokenCache, cloudName, region, cloud, ao, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := wrapTransport(pClient, cloud, cloudName)
+	if err != nil {
+		return nil, err
+	}
+	setServiceEndpoints(rt, pClient)
+
+	return pClient, nil
+}
+
+// NewRateLimiter is a convenience function to get a client-side rate limiter
+// from the rate limits of a clouds.yaml entry. It returns nil, when no limits
+// are set.
+func NewRateLimiter(limits map[string]RateLimitOpts) *client.RateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	limiter := &client.RateLimiter{
+		Limits: make(map[string]client.RateLimits, len(limits)),
+	}
+	for k, v := range limits {
+		l := client.RateLimits{
+			Read:  client.RateLimit{Rate: v.Read, Burst: v.ReadBurst},
+			Write: client.RateLimit{Rate: v.Write, Burst: v.WriteBurst},
+		}
+		if k == "default" {
+			limiter.Default = l
+			continue
+		}
+		limiter.Limits[k] = l
+	}
+
+	return limiter
+}
+
+// NewPolicy is a convenience function to get a client-side policy from the
+// policy of a clouds.yaml entry. The name is reported in the denied request
+// errors. It returns nil, when no policy is set.
+func NewPolicy(name string, opts *PolicyOpts) (*client.Policy, error) {
+	if opts == nil || !opts.ReadOnly && len(opts.Deny) == 0 {
+		return nil, nil
+	}
+
+	policy := &client.Policy{
+		Name:     name,
+		ReadOnly: opts.ReadOnly,
+	}
+	for _, v := range opts.Deny {
+		rule := client.PolicyRule{
+			Methods:  v.Methods,
+			Services: v.Services,
+			Reason:   v.Reason,
+		}
+		if v.Path != "" {
+			path, err := regexp.Compile(v.Path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy rule path %q: %w", v.Path, err)
+			}
+			rule.Path = path
+		}
+		policy.Deny = append(policy.Deny, rule)
+	}
+
+	return policy, nil
+}
+
+// wrapTransport limits the request rate and denies the dangerous requests of
+// the provider client, if the cloud entry sets the rate limits or the policy.
+// It returns nil otherwise.
+//
+// The provider client must be authenticated already, so the policy doesn't
+// deny the requests of the authentication, e.g. to the OpenID Connect
+// identity provider. The reauthentications use a copy of the provider client
+// made while authenticating, so they aren't denied either.
+func wrapTransport(pClient *gophercloud.ProviderClient, cloud *Cloud, cloudName string) (*client.RoundTripper, error) {
+	limiter := NewRateLimiter(cloud.RateLimits)
+	policy, err := NewPolicy(cloudName, cloud.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if limiter == nil && policy == nil {
+		return nil, nil
+	}
+
+	transport := pClient.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	rt := &client.RoundTripper{
+		Rt:          transport,
+		RateLimiter: limiter,
+		Policy:      policy,
+	}
+	pClient.HTTPClient.Transport = rt
+
+	return rt, nil
+}
+
+// setServiceEndpoints sets the service endpoints of the RoundTripper from the
+// service catalog of the provider client. A token restored from the cache is
+// never requested through the RoundTripper, so it can't learn them itself.
+func setServiceEndpoints(rt *client.RoundTripper, pClient *gophercloud.ProviderClient) {
+	if rt == nil {
+		return
+	}
+
+	endpoints := make(map[string]string)
+	switch result := pClient.GetAuthResult().(type) {
+	case interface {
+		ExtractServiceCatalog() (*tokens.ServiceCatalog, error)
+	}:
+		if catalog, err := result.ExtractServiceCatalog(); err == nil {
+			for _, s := range catalog.Entries {
+				for _, e := range s.Endpoints {
+					endpoints[e.URL] = s.Type
+				}
+			}
+		}
+	case tokens2.CreateResult:
+		if catalog, err := result.ExtractServiceCatalog(); err == nil {
+			for _, s := range catalog.Entries {
+				for _, e := range s.Endpoints {
+					for _, u := range []string{e.PublicURL, e.InternalURL, e.AdminURL} {
+						if u != "" {
+							endpoints[u] = s.Type
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(endpoints) > 0 {
+		rt.SetServiceEndpoints(endpoints)
+	}
 }
 
 // NewServiceClient is a convenience function to get a new service client.
@@ -774,6 +1136,17 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 		}
 	}
 
+	pClient, err := newProviderClient(ctx, cloud, cloudName, envPrefix, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newServiceClient(pClient, service, cloud, envPrefix, opts)
+}
+
+// newProviderClient returns a provider client authenticated with the cloud
+// entry or the ClientOpts.
+func newProviderClient(ctx context.Context, cloud *Cloud, cloudName, envPrefix string, opts *ClientOpts) (*gophercloud.ProviderClient, error) {
 	// Check if a custom CA cert was provided.
 	// First, check if the CACERT environment variable is set.
 	var caCertPath string
@@ -821,11 +1194,11 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 	}
 
 	// Get a Provider Client
-	ao, err := AuthOptions(opts)
+	authCloud, ao, err := authOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	pClient, err := openstack.NewClient(ao.IdentityEndpoint)
+	pClient, err := newProvider(authCloud, ao)
 	if err != nil {
 		return nil, err
 	}
@@ -840,28 +1213,26 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 		pClient.HTTPClient = http.Client{Transport: transport}
 	}
 
-	err = openstack.Authenticate(ctx, pClient, *ao)
+	region := regionName(authCloud, envPrefix, opts)
+	err = authenticateWithCache(ctx, pClient, opts.TokenCache, cloudName, region, authCloud, ao, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// Determine the region to use.
-	// First, check if the REGION_NAME environment variable is set.
-	var region string
-	if v := env.Getenv(envPrefix + "REGION_NAME"); v != "" {
-		region = v
+	rt, err := wrapTransport(pClient, cloud, cloudName)
+	if err != nil {
+		return nil, err
 	}
+	setServiceEndpoints(rt, pClient)
 
-	// Next, check if the cloud entry sets a region.
-	if v := cloud.RegionName; v != "" {
-		region = v
-	}
+	return pClient, nil
+}
 
-	// Finally, see if one was specified in the ClientOpts.
-	// If so, this takes precedence.
-	if v := opts.RegionName; v != "" {
-		region = v
-	}
+// newServiceClient returns a service client for the region and the endpoint
+// type set by the environment, the cloud entry or the ClientOpts. The
+// per-service keys of the cloud entry take precedence.
+func newServiceClient(pClient *gophercloud.ProviderClient, service string, cloud *Cloud, envPrefix string, opts *ClientOpts) (*gophercloud.ServiceClient, error) {
+	region := regionName(cloud, envPrefix, opts)
 
 	// Determine the endpoint type to use.
 	// First, check if the OS_INTERFACE environment variable is set.
@@ -875,17 +1246,54 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 		endpointType = v
 	}
 
-	// Finally, see if one was specified in the ClientOpts.
-	// If so, this takes precedence.
+	// Next, see if one was specified in the ClientOpts.
 	if v := opts.EndpointType; v != "" {
 		endpointType = v
 	}
 
+	// Finally, check if the cloud entry sets a region or an interface of the
+	// service. If so, this takes precedence.
+	serviceOpts := cloud.Service(service)
+	if v := serviceOpts.RegionName; v != "" {
+		region = v
+	}
+	if v := serviceOpts.Interface; v != "" {
+		endpointType = v
+	}
+
 	eo := gophercloud.EndpointOpts{
 		Region:       region,
 		Availability: GetEndpointType(endpointType),
 	}
 
+	// The endpoint override replaces the service catalog for the service
+	// client only.
+	client := pClient
+	if v := serviceOpts.EndpointOverride; v != "" {
+		endpoint := gophercloud.NormalizeURL(v)
+		override := *pClient
+		override.EndpointLocator = func(gophercloud.EndpointOpts) (string, error) {
+			return endpoint, nil
+		}
+		client = &override
+	}
+
+	sc, err := initServiceClient(client, service, serviceOpts.APIVersion, eo)
+	if err != nil {
+		return nil, err
+	}
+	sc.ProviderClient = pClient
+
+	if err := setAPIVersion(sc, service, serviceOpts.APIVersion); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// initServiceClient creates the service client of the service with the API
+// version.
+func initServiceClient(pClient *gophercloud.ProviderClient, service, version string, eo gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error) {
 	switch service {
 	case "baremetal":
 		return openstack.NewBareMetalV1(pClient, eo)
@@ -904,15 +1312,12 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 	case "gnocchi":
 		return gnocchi.NewGnocchiV1(pClient, eo)
 	case "identity":
-		identityVersion := "3"
-		if v := cloud.IdentityAPIVersion; v != "" {
-			identityVersion = v
-		}
+		identityVersion, _ := splitAPIVersion(defaultIfEmpty(version, "3"))
 
 		switch identityVersion {
-		case "v2", "2", "2.0":
+		case "2":
 			return openstack.NewIdentityV2(pClient, eo)
-		case "v3", "3":
+		case "3":
 			return openstack.NewIdentityV3(pClient, eo)
 		default:
 			return nil, fmt.Errorf("invalid identity API version")
@@ -940,17 +1345,14 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 	case "sharev2":
 		return openstack.NewSharedFileSystemV2(pClient, eo)
 	case "volume":
-		volumeVersion := "3"
-		if v := cloud.VolumeAPIVersion; v != "" {
-			volumeVersion = v
-		}
+		volumeVersion, _ := splitAPIVersion(defaultIfEmpty(version, "3"))
 
 		switch volumeVersion {
-		case "v1", "1":
+		case "1":
 			return openstack.NewBlockStorageV1(pClient, eo)
-		case "v2", "2":
+		case "2":
 			return openstack.NewBlockStorageV2(pClient, eo)
-		case "v3", "3":
+		case "3":
 			return openstack.NewBlockStorageV3(pClient, eo)
 		default:
 			return nil, fmt.Errorf("invalid volume API version")
@@ -962,6 +1364,29 @@ func NewServiceClient(ctx context.Context, service string, opts *ClientOpts) (*g
 	return nil, fmt.Errorf("unable to create a service client for %s", service)
 }
 
+// regionName determines the region set by the environment, the cloud entry or
+// the ClientOpts.
+func regionName(cloud *Cloud, envPrefix string, opts *ClientOpts) string {
+	// First, check if the REGION_NAME environment variable is set.
+	var region string
+	if v := env.Getenv(envPrefix + "REGION_NAME"); v != "" {
+		region = v
+	}
+
+	// Next, check if the cloud entry sets a region.
+	if v := cloud.RegionName; v != "" {
+		region = v
+	}
+
+	// Finally, see if one was specified in the ClientOpts.
+	// If so, this takes precedence.
+	if v := opts.RegionName; v != "" {
+		region = v
+	}
+
+	return region
+}
+
 // isProjectScoped determines if an auth struct is project scoped.
 func isProjectScoped(authInfo *AuthInfo) bool {
 	if authInfo.ProjectID == "" && authInfo.ProjectName == "" {
@@ -35,6 +35,11 @@ type Cloud struct {
 	IdentityAPIVersion string `yaml:"identity_api_version,omitempty" json:"identity_api_version,omitempty"`
 	VolumeAPIVersion   string `yaml:"volume_api_version,omitempty" json:"volume_api_version,omitempty"`
 
+	// Services are the per-service keys, e.g. compute_endpoint_override,
+	// keyed by the service prefix of the keys, e.g. compute or object_store.
+	// They are looked up by Service.
+	Services map[string]ServiceOpts `yaml:"-" json:"-"`
+
 	// Verify whether or not SSL API requests should be verified.
 	Verify *bool `yaml:"verify,omitempty" json:"verify,omitempty"`
 
@@ -49,6 +54,58 @@ type Cloud struct {
 	// ClientKeyFile a path to a client key to use as part of the SSL
 	// transaction.
 	ClientKeyFile string `yaml:"key,omitempty" json:"key,omitempty"`
+
+	// RateLimits are the client-side request rate limits keyed by a service
+	// type or a host. The "default" key applies to each of the other service
+	// types separately.
+	RateLimits map[string]RateLimitOpts `yaml:"rate_limits,omitempty" json:"rate_limits,omitempty"`
+
+	// Policy denies the dangerous requests to the cloud, e.g. deleting the
+	// production servers.
+	Policy *PolicyOpts `yaml:"policy,omitempty" json:"policy,omitempty"`
+}
+
+// RateLimitOpts represents the client-side rate limits of a service type or a
+// host.
+type RateLimitOpts struct {
+	// Read is the number of GET, HEAD and OPTIONS requests per second.
+	Read float64 `yaml:"read,omitempty" json:"read,omitempty"`
+
+	// ReadBurst is the number of read requests, which may be sent at once.
+	ReadBurst int `yaml:"read_burst,omitempty" json:"read_burst,omitempty"`
+
+	// Write is the number of mutating requests per second.
+	Write float64 `yaml:"write,omitempty" json:"write,omitempty"`
+
+	// WriteBurst is the number of mutating requests, which may be sent at
+	// once.
+	WriteBurst int `yaml:"write_burst,omitempty" json:"write_burst,omitempty"`
+}
+
+// PolicyOpts represents the requests denied by the client.
+type PolicyOpts struct {
+	// ReadOnly denies all but the GET, HEAD and OPTIONS requests.
+	ReadOnly bool `yaml:"read_only,omitempty" json:"read_only,omitempty"`
+
+	// Deny are the rules matching the denied requests.
+	Deny []PolicyRuleOpts `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// PolicyRuleOpts represents a rule matching the denied requests. All the set
+// conditions must match.
+type PolicyRuleOpts struct {
+	// Methods are the HTTP methods, e.g. DELETE. Empty matches all methods.
+	Methods []string `yaml:"methods,omitempty" json:"methods,omitempty"`
+
+	// Services are the service types, e.g. compute. Empty matches all
+	// services. The requests to an unknown service are denied as well.
+	Services []string `yaml:"services,omitempty" json:"services,omitempty"`
+
+	// Path is a regular expression matched against the request URL path.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// Reason explains why the requests are denied.
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
 }
 
 // AuthInfo represents the auth section of a cloud entry or
@@ -69,6 +126,22 @@ type AuthInfo struct {
 	// Password is the password of the user.
 	Password string `yaml:"password,omitempty" json:"password,omitempty"`
 
+	// PasswordCommand is a shell command printing the password of the user,
+	// when Password is not set. It is ignored in clouds-public.yaml.
+	PasswordCommand string `yaml:"password_command,omitempty" json:"password_command,omitempty"`
+
+	// PasswordFile is a file containing the password of the user, when
+	// Password is not set. It takes precedence over PasswordCommand.
+	PasswordFile string `yaml:"password_file,omitempty" json:"password_file,omitempty"`
+
+	// Passcode is the time-based one-time password of the user. It is used
+	// by the v3totp and v3multifactor auth types.
+	Passcode string `yaml:"passcode,omitempty" json:"passcode,omitempty"`
+
+	// AuthMethods are the auth types combined by the v3multifactor auth type.
+	// Only v3password and v3totp are supported. Defaults to both of them.
+	AuthMethods []string `yaml:"auth_methods,omitempty" json:"auth_methods,omitempty"`
+
 	// Application Credential ID to login with.
 	ApplicationCredentialID string `yaml:"application_credential_id,omitempty" json:"application_credential_id,omitempty"`
 
@@ -130,6 +203,40 @@ type AuthInfo struct {
 	// been specified and a domain is required for scope.
 	DefaultDomain string `yaml:"default_domain,omitempty" json:"default_domain,omitempty"`
 
+	// IdentityProvider is the name of the identity provider registered in
+	// Keystone for the OpenID Connect auth types.
+	IdentityProvider string `yaml:"identity_provider,omitempty" json:"identity_provider,omitempty"`
+
+	// Protocol is the name of the federation protocol registered in Keystone
+	// for the identity provider, e.g. openid.
+	Protocol string `yaml:"protocol,omitempty" json:"protocol,omitempty"`
+
+	// ClientID is the OpenID Connect client ID.
+	ClientID string `yaml:"client_id,omitempty" json:"client_id,omitempty"`
+
+	// ClientSecret is the OpenID Connect client secret.
+	ClientSecret string `yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+
+	// DiscoveryEndpoint is the OpenID Connect discovery document URL of the
+	// identity provider. It is used to find the access token endpoint, when
+	// AccessTokenEndpoint is not set.
+	DiscoveryEndpoint string `yaml:"discovery_endpoint,omitempty" json:"discovery_endpoint,omitempty"`
+
+	// AccessTokenEndpoint is the token endpoint URL of the identity provider.
+	AccessTokenEndpoint string `yaml:"access_token_endpoint,omitempty" json:"access_token_endpoint,omitempty"`
+
+	// OpenIDScope is the space separated list of the scopes requested from
+	// the identity provider. Defaults to openid.
+	OpenIDScope string `yaml:"openid_scope,omitempty" json:"openid_scope,omitempty"`
+
+	// AccessToken is a pre-obtained OpenID Connect access token used by the
+	// v3oidcaccesstoken auth type.
+	AccessToken string `yaml:"access_token,omitempty" json:"access_token,omitempty"`
+
+	// Endpoint is the service endpoint URL used by the noauth and http_basic
+	// auth types, which don't use Keystone.
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+
 	// AllowReauth should be set to true if you grant permission for Gophercloud to
 	// cache your credentials in memory, and to allow Gophercloud to attempt to
 	// re-authenticate automatically if/when your token expires.  If you set it to
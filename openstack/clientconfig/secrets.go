@@ -0,0 +1,174 @@
+package clientconfig
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/env"
+)
+
+// SecretResolver resolves the secret references in the auth section of a
+// cloud entry, e.g. a password set to "vault:openstack/production". A
+// resolver is registered for the scheme of the references by
+// RegisterSecretResolver.
+type SecretResolver interface {
+	// ResolveSecret returns the secret of the reference without the
+	// scheme, e.g. "openstack/production".
+	ResolveSecret(ref string) (string, error)
+}
+
+// SecretResolverFunc is an adapter to use a function as a SecretResolver.
+type SecretResolverFunc func(ref string) (string, error)
+
+// ResolveSecret calls f(ref).
+func (f SecretResolverFunc) ResolveSecret(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{
+		"env":  SecretResolverFunc(resolveEnvSecret),
+		"file": SecretResolverFunc(resolveFileSecret),
+	}
+)
+
+// RegisterSecretResolver registers the resolver of the secret references with
+// the scheme, replacing the previous one. The env and file schemes are
+// registered by default, e.g. "env:OS_PROD_PASSWORD" resolves to the value of
+// the environment variable and "file:/run/secrets/password" to the content of
+// the file. A nil resolver unregisters the scheme. The literal scheme is
+// reserved for the secrets starting with a scheme, e.g. "literal:file:abc".
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	if scheme+":" == literalSecretPrefix {
+		return
+	}
+
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+
+	if resolver == nil {
+		delete(secretResolvers, scheme)
+		return
+	}
+	secretResolvers[scheme] = resolver
+}
+
+// literalSecretPrefix escapes the literal secrets, which would be taken for
+// a secret reference otherwise, e.g. "literal:file:abc" is the "file:abc"
+// password.
+const literalSecretPrefix = "literal:"
+
+// resolveSecret resolves the secret reference. The values without a
+// registered scheme, or with the literal: prefix, are literal secrets.
+func resolveSecret(value string) (string, error) {
+	if literal, ok := strings.CutPrefix(value, literalSecretPrefix); ok {
+		return literal, nil
+	}
+
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+
+	secretResolversMu.RLock()
+	resolver, ok := secretResolvers[scheme]
+	secretResolversMu.RUnlock()
+	if !ok {
+		return value, nil
+	}
+
+	return resolver.ResolveSecret(ref)
+}
+
+// resolveSecrets resolves the secret references of the auth info. The
+// password is read from the password_file or the output of the
+// password_command, when it is not set.
+func resolveSecrets(authInfo *AuthInfo) error {
+	secrets := []struct {
+		key   string
+		value *string
+	}{
+		{"password", &authInfo.Password},
+		{"passcode", &authInfo.Passcode},
+		{"token", &authInfo.Token},
+		{"application_credential_secret", &authInfo.ApplicationCredentialSecret},
+		{"client_secret", &authInfo.ClientSecret},
+		{"access_token", &authInfo.AccessToken},
+	}
+	for _, v := range secrets {
+		if *v.value == "" {
+			continue
+		}
+		secret, err := resolveSecret(*v.value)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", v.key, err)
+		}
+		*v.value = secret
+	}
+
+	if authInfo.Password == "" && authInfo.PasswordFile != "" {
+		password, err := resolveFileSecret(authInfo.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to resolve password_file: %w", err)
+		}
+		authInfo.Password = password
+	}
+
+	if authInfo.Password == "" && authInfo.PasswordCommand != "" {
+		password, err := runPasswordCommand(authInfo.PasswordCommand)
+		if err != nil {
+			return fmt.Errorf("failed to resolve password_command: %w", err)
+		}
+		authInfo.Password = password
+	}
+
+	return nil
+}
+
+func resolveEnvSecret(name string) (string, error) {
+	v := env.Getenv(name)
+	if v == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+func resolveFileSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// runPasswordCommand returns the first line of the output of the shell
+// command. The command may prompt the user, e.g. for the passphrase of a
+// password store.
+func runPasswordCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	password, _, _ := strings.Cut(string(out), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("%q printed no password", command)
+	}
+
+	return password, nil
+}
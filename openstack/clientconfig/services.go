@@ -0,0 +1,309 @@
+package clientconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceOpts represents the per-service keys of a cloud entry, e.g.
+// compute_endpoint_override or compute_api_version.
+type ServiceOpts struct {
+	// EndpointOverride is the endpoint of the service, replacing the one of
+	// the service catalog.
+	EndpointOverride string
+
+	// Interface is the interface of the service, replacing the interface of
+	// the cloud entry.
+	Interface string
+
+	// RegionName is the region of the service, replacing the region of the
+	// cloud entry.
+	RegionName string
+
+	// APIVersion is the API version of the service, e.g. 2 or 2.79. The minor
+	// version is sent as the microversion by the services supporting them.
+	APIVersion string
+}
+
+// serviceOptsKeys maps the suffixes of the per-service keys to the fields of
+// ServiceOpts.
+var serviceOptsKeys = []struct {
+	suffix string
+	field  func(*ServiceOpts) *string
+}{
+	{"_endpoint_override", func(o *ServiceOpts) *string { return &o.EndpointOverride }},
+	{"_interface", func(o *ServiceOpts) *string { return &o.Interface }},
+	{"_region_name", func(o *ServiceOpts) *string { return &o.RegionName }},
+	{"_api_version", func(o *ServiceOpts) *string { return &o.APIVersion }},
+}
+
+// serviceKeyPrefixes are the prefixes of the per-service keys of the services
+// supported by NewServiceClient, in the order of precedence. The other
+// services use their name with the dashes replaced by underscores.
+var serviceKeyPrefixes = map[string][]string{
+	"container":       {"application_container", "container"},
+	"container-infra": {"container_infrastructure_management", "container_infra"},
+	"gnocchi":         {"metric", "gnocchi"},
+	"messaging":       {"message", "messaging"},
+	"sharev2":         {"shared_file_system", "sharev2"},
+	"volume":          {"block_storage", "volume"},
+	"workflowv2":      {"workflow"},
+}
+
+// serviceMajorVersions are the major API versions of the services supported
+// by NewServiceClient, which have a single one. The identity and volume
+// services support several major versions.
+var serviceMajorVersions = map[string]string{
+	"baremetal":               "1",
+	"baremetal-introspection": "1",
+	"compute":                 "2",
+	"container":               "1",
+	"container-infra":         "1",
+	"database":                "1",
+	"dns":                     "2",
+	"gnocchi":                 "1",
+	"image":                   "2",
+	"key-manager":             "1",
+	"load-balancer":           "2",
+	"messaging":               "2",
+	"network":                 "2",
+	"object-store":            "1",
+	"orchestration":           "1",
+	"placement":               "1",
+	"sharev2":                 "2",
+	"workflowv2":              "2",
+}
+
+// microversionServices are the services supporting microversions.
+var microversionServices = map[string]struct{}{
+	"baremetal":               {},
+	"baremetal-introspection": {},
+	"compute":                 {},
+	"container":               {},
+	"container-infra":         {},
+	"placement":               {},
+	"sharev2":                 {},
+	"volume":                  {},
+}
+
+// Service returns the per-service keys of the service, e.g. compute or
+// object-store, as named by NewServiceClient. The identity_api_version and
+// volume_api_version keys are the API versions of the identity and volume
+// services.
+func (c *Cloud) Service(service string) ServiceOpts {
+	prefixes, ok := serviceKeyPrefixes[service]
+	if !ok {
+		prefixes = []string{strings.ReplaceAll(service, "-", "_")}
+	}
+
+	var opts ServiceOpts
+	for _, prefix := range prefixes {
+		v := c.Services[prefix]
+		for _, key := range serviceOptsKeys {
+			if field := key.field(&opts); *field == "" {
+				*field = *key.field(&v)
+			}
+		}
+	}
+
+	switch service {
+	case "identity":
+		opts.APIVersion = defaultIfEmpty(opts.APIVersion, c.IdentityAPIVersion)
+	case "volume":
+		opts.APIVersion = defaultIfEmpty(opts.APIVersion, c.VolumeAPIVersion)
+	}
+
+	return opts
+}
+
+// splitAPIVersion splits the API version, e.g. v2.79, into the major version
+// and the microversion.
+func splitAPIVersion(version string) (major, microversion string) {
+	version = strings.TrimPrefix(version, "v")
+	major, _, ok := strings.Cut(version, ".")
+	if !ok {
+		return major, ""
+	}
+	return major, version
+}
+
+// setAPIVersion checks the major API version of the service and sets the
+// microversion of the service client.
+func setAPIVersion(sc *gophercloud.ServiceClient, service, version string) error {
+	if version == "" {
+		return nil
+	}
+
+	major, microversion := splitAPIVersion(version)
+	if v, ok := serviceMajorVersions[service]; ok && v != major {
+		return fmt.Errorf("invalid %s API version %s", service, version)
+	}
+
+	// only the volume v3 API supports microversions
+	if service == "volume" && major != "3" {
+		return nil
+	}
+
+	if _, ok := microversionServices[service]; ok && microversion != "" && microversion != major+".0" {
+		sc.Microversion = microversion
+	}
+
+	return nil
+}
+
+// serviceKey splits a per-service key, e.g. compute_endpoint_override, into
+// the prefix and the field of ServiceOpts. The fields of Cloud aren't
+// per-service keys.
+func serviceKey(key string) (string, func(*ServiceOpts) *string, bool) {
+	if _, ok := cloudFields[key]; ok {
+		return "", nil, false
+	}
+	for _, k := range serviceOptsKeys {
+		if prefix := strings.TrimSuffix(key, k.suffix); prefix != key && prefix != "" {
+			return prefix, k.field, true
+		}
+	}
+	return "", nil, false
+}
+
+// cloudFields are the keys of the fields of Cloud.
+var cloudFields = yamlFields(reflect.TypeOf(Cloud{}))
+
+// setService sets the per-service key of the cloud entry. The other keys are
+// ignored.
+func (c *Cloud) setService(key, value string) {
+	prefix, field, ok := serviceKey(key)
+	if !ok {
+		return
+	}
+	if c.Services == nil {
+		c.Services = make(map[string]ServiceOpts)
+	}
+	opts := c.Services[prefix]
+	*field(&opts) = value
+	c.Services[prefix] = opts
+}
+
+// serviceValues returns the set per-service keys of the cloud entry, sorted
+// by the key.
+func (c Cloud) serviceValues() [][2]string {
+	var values [][2]string
+	for prefix, opts := range c.Services {
+		for _, key := range serviceOptsKeys {
+			if v := *key.field(&opts); v != "" {
+				values = append(values, [2]string{prefix + key.suffix, v})
+			}
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i][0] < values[j][0]
+	})
+	return values
+}
+
+// UnmarshalJSON reads the per-service keys into Services, in addition to the
+// fields of Cloud.
+func (c *Cloud) UnmarshalJSON(data []byte) error {
+	type cloud Cloud
+	var tmp cloud
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	*c = Cloud(tmp)
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for key, raw := range values {
+		// the API versions may be numbers
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		c.setService(key, value)
+	}
+
+	return nil
+}
+
+// MarshalJSON writes Services as the per-service keys, in addition to the
+// fields of Cloud.
+func (c Cloud) MarshalJSON() ([]byte, error) {
+	type cloud Cloud
+	data, err := json.Marshal(cloud(c))
+	if err != nil || len(c.Services) == 0 {
+		return data, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	for _, v := range c.serviceValues() {
+		value, err := json.Marshal(v[1])
+		if err != nil {
+			return nil, err
+		}
+		values[v[0]] = value
+	}
+
+	return json.Marshal(values)
+}
+
+// UnmarshalYAML reads the per-service keys into Services, in addition to the
+// fields of Cloud.
+func (c *Cloud) UnmarshalYAML(node *yaml.Node) error {
+	type cloud Cloud
+	var tmp cloud
+	if err := node.Decode(&tmp); err != nil {
+		return err
+	}
+	*c = Cloud(tmp)
+
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		// the values are kept as written, e.g. an API version of 2.10
+		if value := node.Content[i+1]; value.Kind == yaml.ScalarNode {
+			c.setService(node.Content[i].Value, value.Value)
+		}
+	}
+
+	return nil
+}
+
+// MarshalYAML writes Services as the per-service keys, in addition to the
+// fields of Cloud.
+func (c Cloud) MarshalYAML() (interface{}, error) {
+	type cloud Cloud
+	if len(c.Services) == 0 {
+		return cloud(c), nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(cloud(c)); err != nil {
+		return nil, err
+	}
+	for _, v := range c.serviceValues() {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v[0]},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v[1]},
+		)
+	}
+
+	return &node, nil
+}
+
+// IsZero reports whether the cloud entry is empty, including Services, so the
+// region values setting just the per-service keys aren't omitted.
+func (c Cloud) IsZero() bool {
+	return reflect.DeepEqual(c, Cloud{})
+}
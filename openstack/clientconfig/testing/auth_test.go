@@ -0,0 +1,347 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const authTokenResponse = `{
+  "token": {
+    "expires_at": "2099-01-01T00:00:00.000000Z",
+    "catalog": [
+      {
+        "type": "compute",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%s/compute/v2.1"}
+        ]
+      }
+    ]
+  }
+}`
+
+// fakeIdentity is a fake OpenID Connect identity provider and Keystone.
+type fakeIdentity struct {
+	*httptest.Server
+
+	// forms are the token requests sent to the identity provider
+	forms []map[string]string
+	// methods are the methods of the Keystone token requests
+	methods [][]string
+	// bodies are the Keystone token requests
+	bodies []map[string]interface{}
+}
+
+func newFakeIdentity(t *testing.T) *fakeIdentity {
+	f := new(fakeIdentity)
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/idp/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer": "%[1]s/idp", "token_endpoint": "%[1]s/idp/token"}`, f.URL)
+	})
+
+	mux.HandleFunc("/idp/token", func(w http.ResponseWriter, r *http.Request) {
+		th.AssertNoErr(t, r.ParseForm())
+		clientID, clientSecret, _ := r.BasicAuth()
+		form := map[string]string{
+			"client_id":     clientID,
+			"client_secret": clientSecret,
+		}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		f.forms = append(f.forms, form)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "oidc-access-token", "token_type": "Bearer"}`)
+	})
+
+	mux.HandleFunc("/v3/OS-FEDERATION/identity_providers/myidp/protocols/openid/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer oidc-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Subject-Token", "unscoped-token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"token": {"expires_at": "2099-01-01T00:00:00.000000Z"}}`)
+	})
+
+	mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		th.AssertNoErr(t, json.NewDecoder(r.Body).Decode(&body))
+		f.bodies = append(f.bodies, body)
+
+		var methods []string
+		identity := body["auth"].(map[string]interface{})["identity"].(map[string]interface{})
+		for _, v := range identity["methods"].([]interface{}) {
+			methods = append(methods, v.(string))
+		}
+		f.methods = append(f.methods, methods)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "scoped-token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, authTokenResponse, f.URL)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func TestAuthenticatedClientOIDC(t *testing.T) {
+	idp := newFakeIdentity(t)
+	defer idp.Close()
+
+	authInfo := clientconfig.AuthInfo{
+		AuthURL:           idp.URL + "/v3",
+		IdentityProvider:  "myidp",
+		Protocol:          "openid",
+		ClientID:          "client",
+		ClientSecret:      "secret",
+		DiscoveryEndpoint: idp.URL + "/idp/.well-known/openid-configuration",
+		Username:          "jdoe",
+		Password:          "password",
+		ProjectID:         "12345",
+	}
+
+	pClient, err := clientconfig.AuthenticatedClient(context.TODO(), &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3OIDCPassword,
+		AuthInfo: &authInfo,
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "scoped-token", pClient.Token())
+
+	th.AssertDeepEquals(t, []map[string]string{
+		{
+			"client_id":     "client",
+			"client_secret": "secret",
+			"grant_type":    "password",
+			"username":      "jdoe",
+			"password":      "password",
+			"scope":         "openid",
+		},
+	}, idp.forms)
+
+	// the unscoped federated token is scoped to the project
+	th.AssertDeepEquals(t, [][]string{{"token"}}, idp.methods)
+	th.AssertDeepEquals(t, map[string]interface{}{
+		"identity": map[string]interface{}{
+			"methods": []interface{}{"token"},
+			"token":   map[string]interface{}{"id": "unscoped-token"},
+		},
+		"scope": map[string]interface{}{
+			"project": map[string]interface{}{"id": "12345"},
+		},
+	}, idp.bodies[0]["auth"])
+
+	// the client credentials grant with the configured token endpoint
+	authInfo = clientconfig.AuthInfo{
+		AuthURL:             idp.URL + "/v3",
+		IdentityProvider:    "myidp",
+		Protocol:            "openid",
+		ClientID:            "client",
+		ClientSecret:        "secret",
+		AccessTokenEndpoint: idp.URL + "/idp/token",
+		OpenIDScope:         "openid profile",
+		ProjectID:           "12345",
+	}
+	_, err = clientconfig.AuthenticatedClient(context.TODO(), &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3OIDCClientCredentials,
+		AuthInfo: &authInfo,
+	})
+	th.AssertNoErr(t, err)
+	th.AssertDeepEquals(t, map[string]string{
+		"client_id":     "client",
+		"client_secret": "secret",
+		"grant_type":    "client_credentials",
+		"scope":         "openid profile",
+	}, idp.forms[1])
+}
+
+func TestAuthenticatedClientOIDCPolicy(t *testing.T) {
+	idp := newFakeIdentity(t)
+	defer idp.Close()
+
+	opts := &clientconfig.ClientOpts{
+		Cloud: "sso",
+		YAMLOpts: regionsYAMLOpts{
+			clouds: map[string]clientconfig.Cloud{
+				"sso": {
+					AuthType: clientconfig.AuthV3OIDCPassword,
+					AuthInfo: &clientconfig.AuthInfo{
+						AuthURL:           idp.URL + "/v3",
+						IdentityProvider:  "myidp",
+						Protocol:          "openid",
+						ClientID:          "client",
+						ClientSecret:      "secret",
+						DiscoveryEndpoint: idp.URL + "/idp/.well-known/openid-configuration",
+						Username:          "jdoe",
+						Password:          "password",
+						ProjectID:         "12345",
+					},
+					Policy: &clientconfig.PolicyOpts{ReadOnly: true},
+				},
+			},
+		},
+	}
+
+	// the requests to the identity provider and the federation aren't denied
+	pClient, err := clientconfig.AuthenticatedClient(context.TODO(), opts)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "scoped-token", pClient.Token())
+	th.AssertEquals(t, 1, len(idp.forms))
+
+	request, _ := http.NewRequest(http.MethodPost, idp.URL+"/compute/v2.1/servers", nil)
+	_, err = pClient.HTTPClient.Do(request)
+	var denied client.ErrPolicyDenied
+	th.AssertEquals(t, true, errors.As(err, &denied))
+	th.AssertEquals(t, "read-only mode", denied.Reason)
+}
+
+func TestNewServiceClientOIDCAccessTokenEnv(t *testing.T) {
+	idp := newFakeIdentity(t)
+	defer idp.Close()
+
+	t.Setenv("OS_AUTH_TYPE", "v3oidcaccesstoken")
+	t.Setenv("OS_AUTH_URL", idp.URL+"/v3")
+	t.Setenv("OS_IDENTITY_PROVIDER", "myidp")
+	t.Setenv("OS_PROTOCOL", "openid")
+	t.Setenv("OS_ACCESS_TOKEN", "oidc-access-token")
+	t.Setenv("OS_PROJECT_ID", "12345")
+
+	client, err := clientconfig.NewServiceClient(context.TODO(), "compute", nil)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, idp.URL+"/compute/v2.1/", client.Endpoint)
+
+	// no identity provider requests
+	th.AssertEquals(t, 0, len(idp.forms))
+	th.AssertDeepEquals(t, [][]string{{"token"}}, idp.methods)
+}
+
+func TestAuthenticatedClientMultiFactor(t *testing.T) {
+	idp := newFakeIdentity(t)
+	defer idp.Close()
+
+	authInfo := clientconfig.AuthInfo{
+		AuthURL:        idp.URL + "/v3",
+		Username:       "jdoe",
+		UserDomainName: "Default",
+		Password:       "password",
+		Passcode:       "123456",
+		ProjectID:      "12345",
+	}
+
+	_, err := clientconfig.AuthenticatedClient(context.TODO(), &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3MultiFactor,
+		AuthInfo: &authInfo,
+	})
+	th.AssertNoErr(t, err)
+
+	_, err = clientconfig.AuthenticatedClient(context.TODO(), &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3TOTP,
+		AuthInfo: &authInfo,
+	})
+	th.AssertNoErr(t, err)
+
+	th.AssertDeepEquals(t, [][]string{{"password", "totp"}, {"totp"}}, idp.methods)
+	th.AssertDeepEquals(t, map[string]interface{}{
+		"methods": []interface{}{"totp"},
+		"totp": map[string]interface{}{
+			"user": map[string]interface{}{
+				"name":     "jdoe",
+				"passcode": "123456",
+				"domain":   map[string]interface{}{"name": "Default"},
+			},
+		},
+	}, idp.bodies[1]["auth"].(map[string]interface{})["identity"])
+}
+
+func TestAuthOptionsMultiFactor(t *testing.T) {
+	t.Setenv("OS_PASSCODE", "123456")
+	t.Setenv("OS_AUTH_METHODS", "v3password,v3totp")
+
+	ao, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3MultiFactor,
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "password",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "password", ao.Password)
+	th.AssertEquals(t, "123456", ao.Passcode)
+
+	t.Setenv("OS_AUTH_METHODS", "v3password,v3oidcpassword")
+	_, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3MultiFactor,
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "password",
+		},
+	})
+	th.AssertErr(t, err)
+
+	_, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthV3TOTP,
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL: "https://example.com:5000/v3",
+			UserID:  "abcde",
+		},
+	})
+	th.AssertNoErr(t, err)
+}
+
+func TestNewServiceClientStandalone(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		th.AssertEquals(t, "", r.Header.Get("X-Auth-Token"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client, err := clientconfig.NewServiceClient(context.TODO(), "baremetal", &clientconfig.ClientOpts{
+		AuthType: clientconfig.AuthNoAuth,
+		AuthInfo: &clientconfig.AuthInfo{
+			Endpoint: server.URL,
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, server.URL+"/", client.Endpoint)
+	th.AssertEquals(t, server.URL+"/v1/", client.ResourceBaseURL())
+
+	_, err = client.Get(context.TODO(), client.ServiceURL("nodes"), nil, nil)
+	th.AssertNoErr(t, err)
+
+	t.Setenv("OS_AUTH_TYPE", "http_basic")
+	t.Setenv("OS_ENDPOINT", server.URL+"/v1")
+	t.Setenv("OS_USERNAME", "ironic")
+	t.Setenv("OS_PASSWORD", "secret")
+
+	client, err = clientconfig.NewServiceClient(context.TODO(), "baremetal", nil)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, server.URL+"/v1/", client.ResourceBaseURL())
+
+	_, err = client.Get(context.TODO(), client.ServiceURL("nodes"), nil, nil)
+	th.AssertNoErr(t, err)
+
+	th.AssertDeepEquals(t, []string{"", "Basic aXJvbmljOnNlY3JldA=="}, authorization)
+
+	// the endpoint is required
+	t.Setenv("OS_ENDPOINT", "")
+	_, err = clientconfig.NewServiceClient(context.TODO(), "baremetal", nil)
+	th.AssertErr(t, err)
+}
@@ -0,0 +1,136 @@
+package testing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const editableCloudsYAML = `# Managed by hand, keep the comments
+clouds:
+  # the production cloud
+  production:
+    auth:
+      auth_url: "https://prod.example.com:5000/v3"
+      username: "jdoe"
+      password: "password"
+      project_name: "Some Project"
+    compute_api_version: 2.1
+    region_name: "RegionOne" # the only region
+  staging:
+    auth:
+      auth_url: "https://staging.example.com:5000/v3"
+      token: "token"
+`
+
+const editedCloudsYAML = `# Managed by hand, keep the comments
+clouds:
+  # the production cloud
+  production:
+    auth:
+      auth_url: "https://prod.example.com:5000/v3"
+      username: "jdoe"
+      project_name: "Other Project"
+    compute_api_version: 2.1
+    region_name: "RegionOne" # the only region
+    verify: false
+  developer:
+    auth:
+      auth_url: https://dev.example.com:5000/v3
+      application_credential_id: app-cred-id
+    auth_type: v3applicationcredential
+`
+
+const editedSecureYAML = `clouds:
+  production:
+    auth:
+      password: password
+  developer:
+    auth:
+      application_credential_secret: secret
+`
+
+func TestCloudsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clouds.yaml")
+	th.AssertNoErr(t, os.WriteFile(path, []byte(editableCloudsYAML), 0644))
+
+	f, err := clientconfig.LoadCloudsFile(path, "")
+	th.AssertNoErr(t, err)
+	th.AssertDeepEquals(t, []string{"production", "staging"}, f.Names())
+
+	production, err := f.Get("production")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "password", production.AuthInfo.Password)
+
+	iFalse := false
+	production.AuthInfo.ProjectName = "Other Project"
+	production.Verify = &iFalse
+	th.AssertNoErr(t, f.Update("production", *production))
+
+	th.AssertNoErr(t, f.Delete("staging"))
+	th.AssertErr(t, f.Delete("staging"))
+
+	th.AssertNoErr(t, f.Add("dev", clientconfig.Cloud{
+		AuthType: clientconfig.AuthV3ApplicationCredential,
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:                     "https://dev.example.com:5000/v3",
+			ApplicationCredentialID:     "app-cred-id",
+			ApplicationCredentialSecret: "secret",
+		},
+	}))
+	th.AssertErr(t, f.Add("dev", clientconfig.Cloud{}))
+
+	th.AssertNoErr(t, f.Rename("dev", "developer"))
+	th.AssertErr(t, f.Rename("dev", "developer"))
+
+	th.AssertNoErr(t, f.Save())
+
+	content, err := os.ReadFile(path)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, editedCloudsYAML, string(content))
+
+	securePath := filepath.Join(dir, "secure.yaml")
+	content, err = os.ReadFile(securePath)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, editedSecureYAML, string(content))
+
+	info, err := os.Stat(securePath)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the saved files are read back merged
+	f, err = clientconfig.LoadCloudsFile(path, securePath)
+	th.AssertNoErr(t, err)
+	developer, err := f.Get("developer")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "secret", developer.AuthInfo.ApplicationCredentialSecret)
+	th.AssertEquals(t, "app-cred-id", developer.AuthInfo.ApplicationCredentialID)
+}
+
+func TestCloudsFileNew(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clouds.yaml")
+
+	f, err := clientconfig.LoadCloudsFile(path, "")
+	th.AssertNoErr(t, err)
+	th.AssertNoErr(t, f.Add("hawaii", clientconfig.Cloud{
+		RegionName: "HNL",
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL: "https://hi.example.com:5000/v3",
+		},
+	}))
+	th.AssertNoErr(t, f.Save())
+
+	content, err := os.ReadFile(path)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "clouds:\n  hawaii:\n    auth:\n      auth_url: https://hi.example.com:5000/v3\n    region_name: HNL\n", string(content))
+
+	// no secrets, no secure.yaml
+	_, err = os.Stat(filepath.Join(dir, "secure.yaml"))
+	th.AssertEquals(t, true, os.IsNotExist(err))
+}
@@ -32,6 +32,53 @@ var VirginiaCloudYAML = clientconfig.Cloud{
 	AuthType: "v3applicationcredential",
 }
 
+var OregonCloudYAML = clientconfig.Cloud{
+	RegionName: "OR",
+	AuthInfo: &clientconfig.AuthInfo{
+		AuthURL:     "https://or.example.com:5000/v3",
+		Username:    "jdoe",
+		Password:    "password",
+		ProjectName: "Some Project",
+	},
+	Verify: &iTrue,
+	RateLimits: map[string]clientconfig.RateLimitOpts{
+		"default": {
+			Read:  20,
+			Write: 5,
+		},
+		"compute": {
+			Read:      10,
+			ReadBurst: 20,
+			Write:     2,
+		},
+	},
+}
+
+var MontanaCloudYAML = clientconfig.Cloud{
+	RegionName: "MT",
+	AuthInfo: &clientconfig.AuthInfo{
+		AuthURL:     "https://mt.example.com:5000/v3",
+		Username:    "jdoe",
+		Password:    "password",
+		ProjectName: "Some Project",
+	},
+	Verify: &iTrue,
+	Policy: &clientconfig.PolicyOpts{
+		Deny: []clientconfig.PolicyRuleOpts{
+			{
+				Methods:  []string{"DELETE"},
+				Services: []string{"compute", "volumev3"},
+			},
+			{
+				Methods:  []string{"POST"},
+				Services: []string{"compute"},
+				Path:     "/servers/[^/]+/action$",
+				Reason:   "no server actions in production",
+			},
+		},
+	},
+}
+
 var PhiladelphiaCloudYAML = clientconfig.Cloud{
 	RegionName: "PHL",
 	AuthInfo: &clientconfig.AuthInfo{
@@ -0,0 +1,223 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+	"github.com/vnpaycloud-console/gophercloud/v2"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+// regionsYAMLOpts serves the cloud entries without reading any file.
+type regionsYAMLOpts struct {
+	clouds       map[string]clientconfig.Cloud
+	secureClouds map[string]clientconfig.Cloud
+	publicClouds map[string]clientconfig.Cloud
+}
+
+func (opts regionsYAMLOpts) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return opts.clouds, nil
+}
+
+func (opts regionsYAMLOpts) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return opts.secureClouds, nil
+}
+
+func (opts regionsYAMLOpts) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return opts.publicClouds, nil
+}
+
+const regionsTokenResponse = `{
+  "token": {
+    "expires_at": "2099-01-01T00:00:00.000000Z",
+    "catalog": [
+      {
+        "type": "compute",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%[1]s/one/compute/v2.1"},
+          {"region_id": "RegionTwo", "region": "RegionTwo", "interface": "public", "url": "%[1]s/two/compute/v2.1"},
+          {"region_id": "RegionThree", "region": "RegionThree", "interface": "public", "url": "%[1]s/three/compute/v2.1"}
+        ]
+      }
+    ]
+  }
+}`
+
+func TestNewServiceClients(t *testing.T) {
+	var tokens int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokens, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, regionsTokenResponse, server.URL)
+	}))
+	defer server.Close()
+
+	opts := &clientconfig.ClientOpts{
+		Cloud: "multi",
+		YAMLOpts: regionsYAMLOpts{
+			clouds: map[string]clientconfig.Cloud{
+				"multi": {
+					AuthInfo: &clientconfig.AuthInfo{
+						AuthURL:           server.URL + "/v3",
+						Username:          "jdoe",
+						Password:          "password",
+						ProjectName:       "Some Project",
+						ProjectDomainName: "Default",
+						UserDomainName:    "Default",
+					},
+					Regions: []clientconfig.Region{
+						{Name: "RegionOne"},
+						{Name: "RegionTwo"},
+						{
+							// a separate identity endpoint needs its own token
+							Name: "RegionThree",
+							Values: clientconfig.Cloud{
+								AuthInfo: &clientconfig.AuthInfo{
+									AuthURL: server.URL + "/three/v3",
+								},
+							},
+						},
+						{Name: "RegionFour"},
+					},
+				},
+			},
+		},
+	}
+
+	clients, err := clientconfig.NewServiceClients(context.TODO(), "compute", opts)
+	var regionErrors clientconfig.RegionErrors
+	th.AssertEquals(t, true, errors.As(err, &regionErrors))
+	th.AssertEquals(t, 1, len(regionErrors))
+	th.AssertErr(t, regionErrors["RegionFour"])
+
+	th.AssertEquals(t, 3, len(clients))
+	th.AssertEquals(t, server.URL+"/one/compute/v2.1/", clients["RegionOne"].Endpoint)
+	th.AssertEquals(t, server.URL+"/two/compute/v2.1/", clients["RegionTwo"].Endpoint)
+	th.AssertEquals(t, server.URL+"/three/compute/v2.1/", clients["RegionThree"].Endpoint)
+	th.AssertEquals(t, clients["RegionOne"].ProviderClient, clients["RegionTwo"].ProviderClient)
+	th.AssertEquals(t, int32(2), atomic.LoadInt32(&tokens))
+
+	// only the given regions
+	clients, err = clientconfig.NewServiceClients(context.TODO(), "compute", opts, "RegionTwo")
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 1, len(clients))
+
+	results, err := clientconfig.ForEachRegion(context.TODO(), clients, 2, func(ctx context.Context, region string, client *gophercloud.ServiceClient) (interface{}, error) {
+		return client.Endpoint, nil
+	})
+	th.AssertNoErr(t, err)
+	th.AssertDeepEquals(t, map[string]interface{}{
+		"RegionTwo": server.URL + "/two/compute/v2.1/",
+	}, results)
+}
+
+// countingYAMLOpts counts the loads of clouds.yaml.
+type countingYAMLOpts struct {
+	regionsYAMLOpts
+	loads *int32
+}
+
+func (opts countingYAMLOpts) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	atomic.AddInt32(opts.loads, 1)
+	return opts.regionsYAMLOpts.LoadCloudsYAML()
+}
+
+func TestNewServiceClientsCloudName(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, regionsTokenResponse, server.URL)
+	}))
+	defer server.Close()
+
+	var loads int32
+	yamlOpts := countingYAMLOpts{
+		regionsYAMLOpts: regionsYAMLOpts{
+			clouds: map[string]clientconfig.Cloud{
+				"multi": {
+					AuthInfo: &clientconfig.AuthInfo{
+						AuthURL:   server.URL + "/v3",
+						UserID:    "abcde",
+						Password:  "password",
+						ProjectID: "12345",
+					},
+					Regions: []clientconfig.Region{
+						{Name: "RegionOne"},
+						{Name: "RegionTwo"},
+						{Name: "RegionThree"},
+					},
+					Policy: &clientconfig.PolicyOpts{ReadOnly: true},
+				},
+				"other": {
+					AuthInfo: &clientconfig.AuthInfo{
+						AuthURL: server.URL + "/other/v3",
+					},
+				},
+			},
+		},
+		loads: &loads,
+	}
+
+	// the cloud of the ClientOpts takes precedence over OS_CLOUD
+	t.Setenv("OS_CLOUD", "other")
+	clients, err := clientconfig.NewServiceClients(context.TODO(), "compute", &clientconfig.ClientOpts{
+		Cloud:    "multi",
+		YAMLOpts: yamlOpts,
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 3, len(clients))
+	th.AssertEquals(t, server.URL+"/three/compute/v2.1/", clients["RegionThree"].Endpoint)
+
+	// the policy is named after the cloud
+	_, err = clients["RegionOne"].Delete(context.TODO(), clients["RegionOne"].ServiceURL("servers", "a"), nil)
+	var denied client.ErrPolicyDenied
+	th.AssertEquals(t, true, errors.As(err, &denied))
+	th.AssertEquals(t, "multi", denied.Policy)
+
+	// clouds.yaml is loaded once for all the regions
+	th.AssertEquals(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestForEachRegion(t *testing.T) {
+	clients := map[string]*gophercloud.ServiceClient{
+		"RegionOne":   {Endpoint: "https://one.example.com/"},
+		"RegionTwo":   {Endpoint: "https://two.example.com/"},
+		"RegionThree": {Endpoint: "https://three.example.com/"},
+	}
+
+	var running, maxRunning int32
+	failure := errors.New("unavailable")
+	results, err := clientconfig.ForEachRegion(context.TODO(), clients, 1, func(ctx context.Context, region string, client *gophercloud.ServiceClient) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		if n > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, n)
+		}
+
+		if region == "RegionTwo" {
+			return nil, failure
+		}
+		return client.Endpoint, nil
+	})
+
+	th.AssertEquals(t, int32(1), atomic.LoadInt32(&maxRunning))
+	th.AssertDeepEquals(t, map[string]interface{}{
+		"RegionOne":   "https://one.example.com/",
+		"RegionThree": "https://three.example.com/",
+	}, results)
+	th.AssertEquals(t, true, errors.Is(err, failure))
+	th.AssertEquals(t, "region RegionTwo: unavailable", err.Error())
+}
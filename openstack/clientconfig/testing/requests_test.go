@@ -3,9 +3,11 @@ package testing
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"testing"
 
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
 	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
 	"github.com/vnpaycloud-console/gophercloud/v2"
 
@@ -42,6 +44,8 @@ func TestGetCloudFromYAML(t *testing.T) {
 			RegionName: "PHL2",
 		},
 		"virginia": {Cloud: "virginia"},
+		"oregon":   {Cloud: "oregon"},
+		"montana":  {Cloud: "montana"},
 		"disconnected_smw": {
 			Cloud:      "disconnected_clouds",
 			RegionName: "SOMEWHERE",
@@ -72,6 +76,8 @@ func TestGetCloudFromYAML(t *testing.T) {
 		"philadelphia_phl1":  &PhiladelphiaComplexPhl1CloudYAML,
 		"philadelphia_phl2":  &PhiladelphiaComplexPhl2CloudYAML,
 		"virginia":           &VirginiaCloudYAML,
+		"oregon":             &OregonCloudYAML,
+		"montana":            &MontanaCloudYAML,
 		"disconnected_smw":   &DisconnectedSomewhereCloudYAML,
 		"disconnected_anw":   &DisconnectedAnywhereCloudYAML,
 		"disconnected_now":   &DisconnectedNowhereCloudYAML,
@@ -396,3 +402,48 @@ func TestGetCloudFromYAMLWithCustomYAMLOpts(t *testing.T) {
 		th.AssertDeepEquals(t, expectedClouds[cloud], actual)
 	}
 }
+
+func TestNewRateLimiter(t *testing.T) {
+	th.AssertEquals(t, (*client.RateLimiter)(nil), clientconfig.NewRateLimiter(nil))
+
+	limiter := clientconfig.NewRateLimiter(OregonCloudYAML.RateLimits)
+	th.AssertDeepEquals(t, client.RateLimits{
+		Read:  client.RateLimit{Rate: 20},
+		Write: client.RateLimit{Rate: 5},
+	}, limiter.Default)
+	th.AssertDeepEquals(t, map[string]client.RateLimits{
+		"compute": {
+			Read:  client.RateLimit{Rate: 10, Burst: 20},
+			Write: client.RateLimit{Rate: 2},
+		},
+	}, limiter.Limits)
+}
+
+func TestNewPolicy(t *testing.T) {
+	policy, err := clientconfig.NewPolicy("oregon", OregonCloudYAML.Policy)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, (*client.Policy)(nil), policy)
+
+	policy, err = clientconfig.NewPolicy("montana", MontanaCloudYAML.Policy)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "montana", policy.Name)
+	th.AssertEquals(t, false, policy.ReadOnly)
+	th.AssertEquals(t, 2, len(policy.Deny))
+	th.AssertEquals(t, "/servers/[^/]+/action$", policy.Deny[1].Path.String())
+
+	request, _ := http.NewRequest(http.MethodPost, "https://mt.example.com:8774/v2.1/servers/1/action", nil)
+	err = policy.Check(request, "compute")
+	th.AssertEquals(t, `OpenStack POST request to https://mt.example.com:8774/v2.1/servers/1/action denied by policy "montana": no server actions in production`, err.Error())
+
+	request, _ = http.NewRequest(http.MethodPost, "https://mt.example.com:8774/v2.1/servers", nil)
+	th.AssertNoErr(t, policy.Check(request, "compute"))
+
+	policy, err = clientconfig.NewPolicy("readonly", &clientconfig.PolicyOpts{ReadOnly: true})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, true, policy.ReadOnly)
+
+	_, err = clientconfig.NewPolicy("invalid", &clientconfig.PolicyOpts{
+		Deny: []clientconfig.PolicyRuleOpts{{Path: "("}},
+	})
+	th.AssertErr(t, err)
+}
@@ -0,0 +1,275 @@
+package testing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+func TestAuthOptionsSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	th.AssertNoErr(t, os.WriteFile(secretFile, []byte("app-cred-secret\n"), 0600))
+
+	t.Setenv("TEST_PROD_PASSWORD", "env-password")
+
+	ao, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "env:TEST_PROD_PASSWORD",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "env-password", ao.Password)
+
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:                     "https://example.com:5000/v3",
+			ApplicationCredentialID:     "app-cred-id",
+			ApplicationCredentialSecret: "file:" + secretFile,
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "app-cred-secret", ao.ApplicationCredentialSecret)
+
+	// the values without a registered scheme are literal
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "vault:openstack/production",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "vault:openstack/production", ao.Password)
+
+	// the literal: prefix escapes the registered schemes
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "literal:file:abc",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "file:abc", ao.Password)
+
+	clientconfig.RegisterSecretResolver("vault", clientconfig.SecretResolverFunc(func(ref string) (string, error) {
+		if ref != "openstack/production" {
+			return "", fmt.Errorf("secret %s not found", ref)
+		}
+		return "vault-password", nil
+	}))
+	defer clientconfig.RegisterSecretResolver("vault", nil)
+
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "vault:openstack/production",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "vault-password", ao.Password)
+
+	_, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "vault:openstack/staging",
+		},
+	})
+	th.AssertEquals(t, "failed to resolve password: secret openstack/staging not found", err.Error())
+
+	_, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://example.com:5000/v3",
+			UserID:   "abcde",
+			Password: "env:TEST_MISSING_PASSWORD",
+		},
+	})
+	th.AssertEquals(t, "failed to resolve password: environment variable TEST_MISSING_PASSWORD is not set", err.Error())
+}
+
+func TestAuthOptionsPasswordIndirection(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	th.AssertNoErr(t, os.WriteFile(passwordFile, []byte("file-password\n"), 0600))
+
+	ao, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://example.com:5000/v3",
+			UserID:          "abcde",
+			PasswordFile:    passwordFile,
+			PasswordCommand: "exit 1",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "file-password", ao.Password)
+
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://example.com:5000/v2.0",
+			Username:        "jdoe",
+			PasswordCommand: "echo command-password",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "command-password", ao.Password)
+
+	_, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://example.com:5000/v3",
+			UserID:          "abcde",
+			PasswordCommand: "exit 1",
+		},
+	})
+	th.AssertErr(t, err)
+
+	// the command is not run, when the environment sets the password
+	t.Setenv("OS_PASSWORD", "env-password")
+	ao, err = clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://example.com:5000/v3",
+			UserID:          "abcde",
+			PasswordCommand: "exit 1",
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "env-password", ao.Password)
+}
+
+func TestPasswordCommandRuns(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "command-password") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, regionsTokenResponse, server.URL)
+	}))
+	defer server.Close()
+
+	runs := filepath.Join(t.TempDir(), "runs")
+	countRuns := func() int {
+		b, err := os.ReadFile(runs)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		th.AssertNoErr(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	opts := &clientconfig.ClientOpts{
+		Cloud:      "command",
+		RegionName: "RegionOne",
+		YAMLOpts: regionsYAMLOpts{
+			clouds: map[string]clientconfig.Cloud{
+				"command": {
+					AuthInfo: &clientconfig.AuthInfo{
+						AuthURL:         server.URL + "/v3",
+						UserID:          "abcde",
+						PasswordCommand: fmt.Sprintf("echo run >> %s; echo command-password", runs),
+						ProjectID:       "12345",
+					},
+					Regions: []clientconfig.Region{
+						{Name: "RegionOne"},
+						{Name: "RegionTwo"},
+					},
+				},
+			},
+		},
+	}
+
+	// the regions share the provider client
+	clients, err := clientconfig.NewServiceClients(context.TODO(), "compute", opts)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, len(clients))
+	th.AssertEquals(t, 1, countRuns())
+
+	// the command does not run, when the token is cached
+	opts.TokenCache = &clientconfig.TokenCache{Dir: t.TempDir()}
+	for i := 0; i < 3; i++ {
+		_, err := clientconfig.AuthenticatedClient(context.TODO(), opts)
+		th.AssertNoErr(t, err)
+	}
+	th.AssertEquals(t, 2, countRuns())
+}
+
+func TestValidatorPasswordIndirection(t *testing.T) {
+	diagnostics := clientconfig.Validator{}.ValidateCloud("mixed", &clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://example.com:5000/v3",
+			UserID:          "abcde",
+			Password:        "password",
+			PasswordCommand: "pass show openstack",
+		},
+	})
+	th.AssertDeepEquals(t, []clientconfig.Diagnostic{
+		{
+			Cloud:    "mixed",
+			Severity: clientconfig.SeverityWarning,
+			Message:  "password_command is ignored, as password is set",
+		},
+	}, diagnostics)
+}
+
+func TestPasswordCommandProfile(t *testing.T) {
+	yamlOpts := regionsYAMLOpts{
+		clouds: map[string]clientconfig.Cloud{
+			"public": {
+				Profile: "example",
+				AuthInfo: &clientconfig.AuthInfo{
+					UserID: "abcde",
+				},
+			},
+			"secure": {
+				Profile: "example",
+			},
+		},
+		secureClouds: map[string]clientconfig.Cloud{
+			"secure": {
+				AuthInfo: &clientconfig.AuthInfo{
+					PasswordCommand: "echo secure-password",
+				},
+			},
+		},
+		publicClouds: map[string]clientconfig.Cloud{
+			"example": {
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL:         "https://example.com:5000/v3",
+					PasswordCommand: "echo profile-password",
+				},
+			},
+		},
+	}
+
+	// the profile can't set the password_command
+	cloud, err := clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{Cloud: "public", YAMLOpts: yamlOpts})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "https://example.com:5000/v3", cloud.AuthInfo.AuthURL)
+	th.AssertEquals(t, "", cloud.AuthInfo.PasswordCommand)
+
+	// secure.yaml can
+	cloud, err = clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{Cloud: "secure", YAMLOpts: yamlOpts})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "echo secure-password", cloud.AuthInfo.PasswordCommand)
+
+	// the profile itself is not modified
+	th.AssertEquals(t, "echo profile-password", yamlOpts.publicClouds["example"].AuthInfo.PasswordCommand)
+}
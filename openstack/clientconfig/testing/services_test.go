@@ -0,0 +1,193 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	"gopkg.in/yaml.v3"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const servicesCloudsYAML = `clouds:
+  services:
+    auth:
+      auth_url: "https://example.com:5000/v3"
+    region_name: RegionOne
+    identity_api_version: 3
+    compute_api_version: 2.10
+    compute_interface: internal
+    object_store_endpoint_override: https://swift.example.com/v1/AUTH_12345
+    block_storage_region_name: RegionTwo
+    volume_api_version: 3.59
+    load_balancer_interface: admin
+    regions:
+      - name: RegionTwo
+        values:
+          compute_endpoint_override: https://nova.example.com/v2.1
+`
+
+const servicesTokenResponse = `{
+  "token": {
+    "expires_at": "2099-01-01T00:00:00.000000Z",
+    "catalog": [
+      {
+        "type": "compute",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%[1]s/one/compute/v2.1"},
+          {"region_id": "RegionTwo", "region": "RegionTwo", "interface": "internal", "url": "%[1]s/two/compute/v2.1"}
+        ]
+      },
+      {
+        "type": "network",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%[1]s/one/network"}
+        ]
+      }
+    ]
+  }
+}`
+
+func TestCloudServices(t *testing.T) {
+	var clouds clientconfig.Clouds
+	th.AssertNoErr(t, yaml.Unmarshal([]byte(servicesCloudsYAML), &clouds))
+
+	cloud := clouds.Clouds["services"]
+	th.AssertDeepEquals(t, map[string]clientconfig.ServiceOpts{
+		"compute":       {Interface: "internal", APIVersion: "2.10"},
+		"object_store":  {EndpointOverride: "https://swift.example.com/v1/AUTH_12345"},
+		"block_storage": {RegionName: "RegionTwo"},
+		"load_balancer": {Interface: "admin"},
+	}, cloud.Services)
+	th.AssertEquals(t, "3", cloud.IdentityAPIVersion)
+	th.AssertEquals(t, "3.59", cloud.VolumeAPIVersion)
+
+	th.AssertDeepEquals(t, map[string]clientconfig.ServiceOpts{
+		"compute": {EndpointOverride: "https://nova.example.com/v2.1"},
+	}, cloud.Regions[0].Values.Services)
+
+	th.AssertEquals(t, clientconfig.ServiceOpts{
+		RegionName: "RegionTwo",
+		APIVersion: "3.59",
+	}, cloud.Service("volume"))
+	th.AssertEquals(t, "https://swift.example.com/v1/AUTH_12345", cloud.Service("object-store").EndpointOverride)
+	th.AssertEquals(t, "admin", cloud.Service("load-balancer").Interface)
+	th.AssertEquals(t, "3", cloud.Service("identity").APIVersion)
+	th.AssertEquals(t, clientconfig.ServiceOpts{}, cloud.Service("network"))
+
+	// the per-service keys survive the round trips
+	b, err := json.Marshal(cloud)
+	th.AssertNoErr(t, err)
+	var fromJSON clientconfig.Cloud
+	th.AssertNoErr(t, json.Unmarshal(b, &fromJSON))
+	th.AssertDeepEquals(t, cloud, fromJSON)
+
+	b, err = yaml.Marshal(cloud)
+	th.AssertNoErr(t, err)
+	var fromYAML clientconfig.Cloud
+	th.AssertNoErr(t, yaml.Unmarshal(b, &fromYAML))
+	th.AssertDeepEquals(t, cloud, fromYAML)
+
+	// the region values override the ones of the cloud entry
+	merged, err := clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{
+		Cloud:      "services",
+		RegionName: "RegionTwo",
+		YAMLOpts: regionsYAMLOpts{
+			clouds: clouds.Clouds,
+		},
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, clientconfig.ServiceOpts{
+		EndpointOverride: "https://nova.example.com/v2.1",
+		Interface:        "internal",
+		APIVersion:       "2.10",
+	}, merged.Service("compute"))
+}
+
+func TestNewServiceClientServices(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, servicesTokenResponse, server.URL)
+	}))
+	defer server.Close()
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:        server.URL + "/v3",
+			Username:       "jdoe",
+			Password:       "password",
+			UserDomainName: "Default",
+			ProjectID:      "12345",
+		},
+		RegionName: "RegionOne",
+		Services: map[string]clientconfig.ServiceOpts{
+			"compute": {
+				Interface:  "internal",
+				RegionName: "RegionTwo",
+				APIVersion: "2.79",
+			},
+			"network": {
+				EndpointOverride: server.URL + "/neutron",
+			},
+		},
+	}
+	opts := &clientconfig.ClientOpts{
+		Cloud: "services",
+		YAMLOpts: regionsYAMLOpts{
+			clouds: map[string]clientconfig.Cloud{"services": cloud},
+		},
+	}
+
+	client, err := clientconfig.NewServiceClient(context.TODO(), "compute", opts)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, server.URL+"/two/compute/v2.1/", client.Endpoint)
+	th.AssertEquals(t, "2.79", client.Microversion)
+
+	client, err = clientconfig.NewServiceClient(context.TODO(), "network", opts)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, server.URL+"/neutron/", client.Endpoint)
+	th.AssertEquals(t, server.URL+"/neutron/v2.0/", client.ResourceBaseURL())
+	th.AssertEquals(t, "token", client.Token())
+
+	// the endpoint override doesn't replace the service catalog
+	url, err := client.ProviderClient.EndpointLocator(gophercloud.EndpointOpts{
+		Type:         "network",
+		Region:       "RegionOne",
+		Availability: gophercloud.AvailabilityPublic,
+	})
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, server.URL+"/one/network/", url)
+
+	cloud.Services["compute"] = clientconfig.ServiceOpts{APIVersion: "3"}
+	_, err = clientconfig.NewServiceClient(context.TODO(), "compute", opts)
+	th.AssertEquals(t, "invalid compute API version 3", err.Error())
+}
+
+func TestValidatorServices(t *testing.T) {
+	diagnostics := clientconfig.Validator{}.ValidateCloud("services", &clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL: "https://example.com:5000/v3",
+			Token:   "token",
+		},
+		Services: map[string]clientconfig.ServiceOpts{
+			"compute": {Interface: "internal"},
+			"network": {Interface: "private"},
+		},
+	})
+	th.AssertDeepEquals(t, []clientconfig.Diagnostic{
+		{
+			Cloud:    "services",
+			Severity: clientconfig.SeverityError,
+			Message:  `invalid network_interface "private", must be one of public, internal, admin, publicURL, internalURL or adminURL`,
+		},
+	}, diagnostics)
+}
@@ -0,0 +1,266 @@
+package testing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const tokenCacheResponse = `{
+  "token": {
+    "expires_at": "%s",
+    "catalog": [
+      {
+        "type": "compute",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%s/compute/v2.1"}
+        ]
+      }
+    ]
+  }
+}`
+
+func newTokenCacheServer(tokens *int32, expiresAt time.Time) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(tokens, 1)
+		// give the other clients the time to miss the cache
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, tokenCacheResponse, expiresAt.UTC().Format(time.RFC3339), server.URL)
+	}))
+	return server
+}
+
+func tokenCacheOpts(authURL, projectID string, cache *clientconfig.TokenCache) *clientconfig.ClientOpts {
+	return &clientconfig.ClientOpts{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:        authURL,
+			Username:       "jdoe",
+			Password:       "password",
+			UserDomainName: "Default",
+			ProjectID:      projectID,
+		},
+		RegionName: "RegionOne",
+		TokenCache: cache,
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	var tokens int32
+	server := newTokenCacheServer(&tokens, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "tokens")
+	cache := &clientconfig.TokenCache{Dir: dir}
+
+	pClient, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "token-1", pClient.Token())
+
+	// the cached token and catalog are reused
+	client, err := clientconfig.NewServiceClient(context.TODO(), "compute", tokenCacheOpts(server.URL+"/v3", "12345", cache))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "token-1", client.Token())
+	th.AssertEquals(t, server.URL+"/compute/v2.1/", client.Endpoint)
+	th.AssertEquals(t, int32(1), atomic.LoadInt32(&tokens))
+
+	// another scope needs another token
+	pClient, err = clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "67890", cache))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "token-2", pClient.Token())
+
+	// without the cache
+	pClient, err = clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", nil))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "token-3", pClient.Token())
+
+	info, err := os.Stat(dir)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, os.FileMode(0700), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 2, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		th.AssertNoErr(t, err)
+		th.AssertEquals(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestTokenCacheDirPermissions(t *testing.T) {
+	var tokens int32
+	server := newTokenCacheServer(&tokens, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	// an existing directory readable by the others
+	dir := filepath.Join(t.TempDir(), "tokens")
+	th.AssertNoErr(t, os.Mkdir(dir, 0755))
+	th.AssertNoErr(t, os.Chmod(dir, 0755))
+
+	cache := &clientconfig.TokenCache{Dir: dir}
+	_, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+	th.AssertNoErr(t, err)
+
+	info, err := os.Stat(dir)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, os.FileMode(0700), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 1, len(entries))
+}
+
+func TestTokenCacheExpiry(t *testing.T) {
+	var tokens int32
+	server := newTokenCacheServer(&tokens, time.Now().Add(2*time.Minute))
+	defer server.Close()
+
+	cache := &clientconfig.TokenCache{Dir: t.TempDir()}
+
+	// the token expires within the default margin
+	for i := 0; i < 2; i++ {
+		_, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+		th.AssertNoErr(t, err)
+	}
+	th.AssertEquals(t, int32(2), atomic.LoadInt32(&tokens))
+
+	cache.ExpiryMargin = time.Minute
+	_, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, int32(2), atomic.LoadInt32(&tokens))
+}
+
+func TestTokenCacheConcurrency(t *testing.T) {
+	var tokens int32
+	server := newTokenCacheServer(&tokens, time.Now().Add(time.Hour))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// separate caches share the directory, the same as processes
+			cache := &clientconfig.TokenCache{Dir: dir}
+			pClient, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+			if err == nil && pClient.Token() != "token-1" {
+				err = fmt.Errorf("unexpected token %s", pClient.Token())
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		th.AssertNoErr(t, err)
+	}
+	th.AssertEquals(t, int32(1), atomic.LoadInt32(&tokens))
+
+	// a lock left by a crashed process is broken
+	entries, err := os.ReadDir(dir)
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, 1, len(entries))
+
+	path := filepath.Join(dir, entries[0].Name())
+	th.AssertNoErr(t, os.Remove(path))
+	th.AssertNoErr(t, os.WriteFile(path+".lock", nil, 0600))
+	past := time.Now().Add(-time.Hour)
+	th.AssertNoErr(t, os.Chtimes(path+".lock", past, past))
+
+	cache := &clientconfig.TokenCache{Dir: dir, LockTimeout: time.Minute}
+	pClient, err := clientconfig.AuthenticatedClient(context.TODO(), tokenCacheOpts(server.URL+"/v3", "12345", cache))
+	th.AssertNoErr(t, err)
+	th.AssertEquals(t, "token-2", pClient.Token())
+}
+
+const policyTokenResponse = `{
+  "token": {
+    "expires_at": "2099-01-01T00:00:00.000000Z",
+    "catalog": [
+      {
+        "type": "compute",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%[1]s/nova/v2.1"}
+        ]
+      },
+      {
+        "type": "network",
+        "endpoints": [
+          {"region_id": "RegionOne", "region": "RegionOne", "interface": "public", "url": "%[1]s/neutron"}
+        ]
+      }
+    ]
+  }
+}`
+
+func TestAuthenticatedClientPolicy(t *testing.T) {
+	var tokens int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/auth/tokens" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		atomic.AddInt32(&tokens, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "token")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, policyTokenResponse, server.URL)
+	}))
+	defer server.Close()
+
+	opts := tokenCacheOpts(server.URL+"/v3", "12345", &clientconfig.TokenCache{Dir: t.TempDir()})
+	opts.Cloud = "production"
+	opts.YAMLOpts = regionsYAMLOpts{
+		clouds: map[string]clientconfig.Cloud{
+			"production": {
+				Policy: &clientconfig.PolicyOpts{
+					Deny: []clientconfig.PolicyRuleOpts{
+						{Methods: []string{http.MethodDelete}, Services: []string{"compute"}},
+					},
+				},
+			},
+		},
+	}
+
+	// the service endpoints are known with and without the cached token
+	for i := 0; i < 2; i++ {
+		pClient, err := clientconfig.AuthenticatedClient(context.TODO(), opts)
+		th.AssertNoErr(t, err)
+
+		request, _ := http.NewRequest(http.MethodDelete, server.URL+"/nova/v2.1/servers/1", nil)
+		_, err = pClient.HTTPClient.Do(request)
+		var denied client.ErrPolicyDenied
+		th.AssertEquals(t, true, errors.As(err, &denied))
+		th.AssertEquals(t, "production", denied.Policy)
+		th.AssertEquals(t, "compute", denied.Service)
+
+		request, _ = http.NewRequest(http.MethodDelete, server.URL+"/neutron/v2.0/ports/1", nil)
+		response, err := pClient.HTTPClient.Do(request)
+		th.AssertNoErr(t, err)
+		response.Body.Close()
+		th.AssertEquals(t, http.StatusNoContent, response.StatusCode)
+	}
+	th.AssertEquals(t, int32(1), atomic.LoadInt32(&tokens))
+}
@@ -0,0 +1,107 @@
+package testing
+
+import (
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+
+	th "github.com/vnpaycloud-console/gophercloud/v2/testhelper"
+)
+
+const invalidCloudsYAML = `clouds:
+  valid:
+    profile: rackspace
+    compute_api_version: "2.1"
+    auth:
+      auth_url: "https://valid.example.com:5000/v3"
+      username: "jdoe"
+      password: "password"
+      project_name: "Some Project"
+      project_domain_name: "Default"
+  invalid:
+    auth:
+      auth_url: "https://invalid.example.com:5000/v3"
+      usrname: "jdoe"
+      password: "password"
+      token: "token"
+      project_id: "12345"
+      project_name: "Some Project"
+      application_credential_name: "app-cred"
+    interface: "private"
+    cacert: "/nonexistent/ca.pem"
+    profile: "nowhere"
+    regions:
+      - name: "RegionOne"
+        values:
+          regoin_name: "RegionOne"
+`
+
+func TestValidator(t *testing.T) {
+	diagnostics, err := clientconfig.Validator{}.Validate("clouds.yaml", []byte(invalidCloudsYAML))
+	th.AssertNoErr(t, err)
+
+	var actual []string
+	for _, d := range diagnostics {
+		actual = append(actual, d.String())
+	}
+
+	th.AssertDeepEquals(t, []string{
+		"clouds.yaml:14:7: warning: cloud invalid: unknown key auth.usrname",
+		"clouds.yaml:16:7: error: cloud invalid: token and password are mutually exclusive",
+		"clouds.yaml:18:7: error: cloud invalid: project_id and project_name are mutually exclusive",
+		"clouds.yaml:19:7: error: cloud invalid: application_credential_name requires username or user_id",
+		`clouds.yaml:20:16: error: cloud invalid: invalid interface "private", must be one of public, internal, admin, publicURL, internalURL or adminURL`,
+		"clouds.yaml:21:13: error: cloud invalid: cacert file is not readable: open /nonexistent/ca.pem: no such file or directory",
+		"clouds.yaml:22:14: error: cloud invalid: profile nowhere does not exist in clouds-public.yaml",
+		"clouds.yaml:26:11: warning: cloud invalid: unknown key regions.0.values.regoin_name",
+	}, actual)
+}
+
+func TestValidatorCloud(t *testing.T) {
+	diagnostics := clientconfig.Validator{}.ValidateCloud("oregon", &OregonCloudYAML)
+	th.AssertDeepEquals(t, []clientconfig.Diagnostic{
+		{
+			Cloud:    "oregon",
+			Severity: clientconfig.SeverityError,
+			Message:  "project_name requires project_domain_name or project_domain_id",
+		},
+	}, diagnostics)
+
+	th.AssertEquals(t, 0, len(clientconfig.Validator{}.ValidateCloud("hawaii", &HawaiiCloudYAML)))
+}
+
+const secureValidatedCloudsYAML = `clouds:
+  split:
+    auth:
+      auth_url: "https://split.example.com:5000/v3"
+      token: "token"
+      application_credential_name: "app-cred"
+`
+
+func TestValidatorSecureYAML(t *testing.T) {
+	validator := clientconfig.Validator{
+		YAMLOpts: regionsYAMLOpts{
+			secureClouds: map[string]clientconfig.Cloud{
+				"split": {
+					AuthInfo: &clientconfig.AuthInfo{
+						Username: "jdoe",
+						Password: "password",
+					},
+				},
+			},
+		},
+	}
+
+	diagnostics, err := validator.Validate("clouds.yaml", []byte(secureValidatedCloudsYAML))
+	th.AssertNoErr(t, err)
+
+	var actual []string
+	for _, d := range diagnostics {
+		actual = append(actual, d.String())
+	}
+
+	// the username and the password are set by secure.yaml
+	th.AssertDeepEquals(t, []string{
+		"clouds.yaml:5:7: error: cloud split: token and password are mutually exclusive",
+	}, actual)
+}
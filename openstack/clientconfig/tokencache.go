@@ -0,0 +1,368 @@
+package clientconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vnpaycloud-console/gophercloud/v2"
+	"github.com/vnpaycloud-console/gophercloud/v2/openstack"
+	"github.com/vnpaycloud-console/gophercloud/v2/openstack/identity/v3/tokens"
+)
+
+const (
+	// DefaultTokenCacheExpiryMargin is the default time before the expiry of
+	// a cached token, after which the token is no longer used.
+	DefaultTokenCacheExpiryMargin = 5 * time.Minute
+
+	// DefaultTokenCacheLockTimeout is the default age, after which the lock
+	// of a cache entry is considered to be left by a crashed process.
+	DefaultTokenCacheLockTimeout = 30 * time.Second
+)
+
+// lockRetryInterval is the interval between the attempts to lock a cache
+// entry.
+const lockRetryInterval = 50 * time.Millisecond
+
+// TokenCache is an on-disk cache of the Keystone v3 tokens together with
+// their service catalogs, which is shared by the processes using the same
+// directory. It is enabled by setting ClientOpts.TokenCache.
+//
+// The tokens are cached by the cloud name, the auth URL, the user, the scope
+// and the region. The processes, which miss the cache at the same time, wait
+// for a single one of them to authenticate. The directory is created with the
+// 0700 permissions and the cache entries with the 0600 permissions, as the
+// tokens are credentials.
+//
+// The tokens of the Identity v2 API, the pre-generated tokens and the
+// services without Keystone are not cached.
+type TokenCache struct {
+	// Dir is the cache directory. Defaults to the openstack/tokens directory
+	// in the user cache directory, e.g. ~/.cache/openstack/tokens. The
+	// permissions of an existing directory are restricted to the owner, or
+	// the cache is not used, when they can't be.
+	Dir string
+
+	// ExpiryMargin is the time before the expiry of a cached token, after
+	// which the token is no longer used. Defaults to
+	// DefaultTokenCacheExpiryMargin.
+	ExpiryMargin time.Duration
+
+	// LockTimeout is the age, after which the lock of a cache entry is
+	// considered to be left by a crashed process and is removed. Defaults to
+	// DefaultTokenCacheLockTimeout.
+	LockTimeout time.Duration
+}
+
+// tokenCacheKey identifies the cached token.
+type tokenCacheKey struct {
+	Cloud                     string                 `json:"cloud,omitempty"`
+	AuthURL                   string                 `json:"auth_url"`
+	AuthType                  AuthType               `json:"auth_type,omitempty"`
+	UserID                    string                 `json:"user_id,omitempty"`
+	Username                  string                 `json:"username,omitempty"`
+	UserDomainID              string                 `json:"user_domain_id,omitempty"`
+	UserDomainName            string                 `json:"user_domain_name,omitempty"`
+	ApplicationCredentialID   string                 `json:"application_credential_id,omitempty"`
+	ApplicationCredentialName string                 `json:"application_credential_name,omitempty"`
+	IdentityProvider          string                 `json:"identity_provider,omitempty"`
+	ClientID                  string                 `json:"client_id,omitempty"`
+	Scope                     *gophercloud.AuthScope `json:"scope,omitempty"`
+	Region                    string                 `json:"region,omitempty"`
+}
+
+// cachedToken is a cache entry.
+type cachedToken struct {
+	TokenID   string          `json:"token_id"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Token     json.RawMessage `json:"token"`
+}
+
+// authenticateWithCache authenticates the provider client with the token
+// cached for the cloud entry resolved by authOptions. A new token is cached,
+// when there is none. Without a cache, or when the cloud entry isn't
+// cacheable, the provider client is just authenticated.
+//
+// The secrets of the cloud entry are resolved only when the provider client
+// really authenticates, e.g. the password_command doesn't run, when the
+// token is cached.
+func authenticateWithCache(ctx context.Context, pClient *gophercloud.ProviderClient, cache *TokenCache, cloudName, region string, cloud *Cloud, ao *gophercloud.AuthOptions, opts *ClientOpts) error {
+	resolve := lazyAuthOptions(cloud, opts)
+	auth := func(ctx context.Context, pClient *gophercloud.ProviderClient) error {
+		cloud, ao, err := resolve()
+		if err != nil {
+			return err
+		}
+		return authenticate(ctx, pClient, cloud, ao)
+	}
+
+	if cache == nil || isStandaloneAuth(cloud.AuthType) || ao.TokenID != "" || determineIdentityAPI(cloud, opts) != "3" {
+		return auth(ctx, pClient)
+	}
+
+	path, err := cache.path(tokenCacheKey{
+		Cloud:                     cloudName,
+		AuthURL:                   ao.IdentityEndpoint,
+		AuthType:                  cloud.AuthType,
+		UserID:                    ao.UserID,
+		Username:                  defaultIfEmpty(ao.Username, cloud.AuthInfo.Username),
+		UserDomainID:              ao.DomainID,
+		UserDomainName:            ao.DomainName,
+		ApplicationCredentialID:   ao.ApplicationCredentialID,
+		ApplicationCredentialName: ao.ApplicationCredentialName,
+		IdentityProvider:          cloud.AuthInfo.IdentityProvider,
+		ClientID:                  cloud.AuthInfo.ClientID,
+		Scope:                     ao.Scope,
+		Region:                    region,
+	})
+	if err != nil {
+		// An unusable cache must not prevent the authentication.
+		return auth(ctx, pClient)
+	}
+
+	// The token of the reauthentication is cached as well.
+	setReauth := func() error {
+		if !ao.AllowReauth {
+			return nil
+		}
+		reauth, err := throwawayReauth(pClient, func(ctx context.Context, tac *gophercloud.ProviderClient) error {
+			cloud, ao, err := resolve()
+			if err != nil {
+				return err
+			}
+			reauthOpts := *ao
+			reauthOpts.AllowReauth = false
+			if err := authenticate(ctx, tac, cloud, &reauthOpts); err != nil {
+				return err
+			}
+			cache.store(path, tac)
+			return nil
+		})
+		pClient.ReauthFunc = reauth
+		return err
+	}
+
+	if cache.restore(pClient, path) {
+		return setReauth()
+	}
+
+	// Wait for another process, which may be authenticating already.
+	unlock, err := cache.lock(ctx, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return auth(ctx, pClient)
+	}
+	defer unlock()
+
+	if cache.restore(pClient, path) {
+		return setReauth()
+	}
+
+	if err := auth(ctx, pClient); err != nil {
+		return err
+	}
+	cache.store(path, pClient)
+
+	return setReauth()
+}
+
+// lazyAuthOptions returns a function resolving the secrets of the cloud entry
+// by resolveAuthOptions on the first call. The resolved AuthOptions are kept
+// for the reauthentications.
+func lazyAuthOptions(cloud *Cloud, opts *ClientOpts) func() (*Cloud, *gophercloud.AuthOptions, error) {
+	var (
+		mu            sync.Mutex
+		resolvedCloud *Cloud
+		resolvedAO    *gophercloud.AuthOptions
+	)
+	return func() (*Cloud, *gophercloud.AuthOptions, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if resolvedAO == nil {
+			c, ao, err := resolveAuthOptions(cloud, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			resolvedCloud, resolvedAO = c, ao
+		}
+		return resolvedCloud, resolvedAO, nil
+	}
+}
+
+// path returns the path of the cache entry, creating the cache directory.
+func (c *TokenCache) path(key tokenCacheKey) (string, error) {
+	dir := c.Dir
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cacheDir, "openstack", "tokens")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// an existing directory must not be readable by the others either
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("token cache %s is not a directory", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", fmt.Errorf("token cache %s is accessible by the others: %w", dir, err)
+		}
+	}
+
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// restore sets the cached token and the service catalog of the provider
+// client. It returns false, when there is no cached token, or it is about to
+// expire.
+func (c *TokenCache) restore(pClient *gophercloud.ProviderClient, path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var entry cachedToken
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return false
+	}
+
+	expiryMargin := c.ExpiryMargin
+	if expiryMargin == 0 {
+		expiryMargin = DefaultTokenCacheExpiryMargin
+	}
+	if time.Now().Add(expiryMargin).After(entry.ExpiresAt) {
+		return false
+	}
+
+	var result tokens.CreateResult
+	result.Body = entry.Token
+	result.Header = http.Header{}
+	result.Header.Set("X-Subject-Token", entry.TokenID)
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return false
+	}
+
+	if err := pClient.SetTokenAndAuthResult(result); err != nil {
+		return false
+	}
+	pClient.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
+		return openstack.V3EndpointURL(catalog, opts)
+	}
+
+	return true
+}
+
+// store caches the token of the authenticated provider client. The errors
+// are ignored, as the token is just requested again.
+func (c *TokenCache) store(path string, pClient *gophercloud.ProviderClient) {
+	var body interface{}
+	var token *tokens.Token
+	var err error
+	switch result := pClient.GetAuthResult().(type) {
+	case tokens.CreateResult:
+		body = result.Body
+		token, err = result.ExtractToken()
+	case tokens.GetResult:
+		body = result.Body
+		token, err = result.ExtractToken()
+	default:
+		return
+	}
+	if err != nil || token.ExpiresAt.IsZero() {
+		return
+	}
+
+	entry := cachedToken{
+		TokenID:   pClient.Token(),
+		ExpiresAt: token.ExpiresAt,
+	}
+	entry.Token, err = json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	// Write the entry atomically, so the other processes never read a
+	// partial entry. The temporary file is created with the 0600
+	// permissions.
+	f, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return
+	}
+	if err := f.Close(); err != nil {
+		return
+	}
+
+	os.Rename(f.Name(), path)
+}
+
+// lock locks the cache entry for the other processes by creating a lock file
+// next to it. The lock is removed by the returned function.
+func (c *TokenCache) lock(ctx context.Context, path string) (func(), error) {
+	lockTimeout := c.LockTimeout
+	if lockTimeout == 0 {
+		lockTimeout = DefaultTokenCacheLockTimeout
+	}
+
+	lockPath := path + ".lock"
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// Break the lock left by a crashed process.
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(lockPath)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package clientconfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity string
+
+const (
+	// SeverityError marks a configuration, which fails or is ignored at
+	// runtime.
+	SeverityError Severity = "error"
+
+	// SeverityWarning marks a configuration, which is likely a mistake.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single problem found by the Validator.
+type Diagnostic struct {
+	// File is the path of the validated file. It is empty for the
+	// validated Cloud structs.
+	File string
+	// Line and Column are the 1-based position of the offending YAML node.
+	// They are zero for the validated Cloud structs.
+	Line   int
+	Column int
+	// Cloud is the name of the cloud entry.
+	Cloud    string
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	var position string
+	if d.File != "" {
+		position = d.File + ":"
+	}
+	if d.Line > 0 {
+		position += fmt.Sprintf("%d:%d:", d.Line, d.Column)
+	}
+	if position != "" {
+		position += " "
+	}
+
+	var cloud string
+	if d.Cloud != "" {
+		cloud = fmt.Sprintf("cloud %s: ", d.Cloud)
+	}
+
+	return fmt.Sprintf("%s%s: %s%s", position, d.Severity, cloud, d.Message)
+}
+
+// Validator checks the clouds.yaml entries for the mistakes, which would
+// otherwise surface as opaque authentication errors at runtime.
+type Validator struct {
+	// YAMLOpts is used to load the secure.yaml entries, which are merged
+	// into the validated clouds.yaml entries, and the public clouds, which
+	// are referred by the profiles. Defaults to YAMLOpts.
+	YAMLOpts YAMLOptsBuilder
+}
+
+// List of cloud entry key suffixes of the per service options supported by
+// the openstacksdk, which are not kept in ServiceOpts, e.g.
+// compute_service_type.
+var otherServiceKeySuffixes = []string{
+	"_service_type",
+	"_service_name",
+}
+
+// List of valid interface and endpoint_type values.
+var validInterfaces = []string{
+	"public",
+	"internal",
+	"admin",
+	"publicURL",
+	"internalURL",
+	"adminURL",
+}
+
+// ValidateFile validates a clouds.yaml file.
+func (v Validator) ValidateFile(path string) ([]Diagnostic, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return v.Validate(path, content)
+}
+
+// Validate validates the content of a clouds.yaml file. The file is only
+// used in the diagnostics. The entries are merged with the secure.yaml
+// entries the same way as by GetCloudFromYAML.
+func (v Validator) Validate(file string, content []byte) ([]Diagnostic, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+
+	d := &diagnostics{file: file}
+
+	clouds := cloudsNode(&doc, false)
+	if clouds == nil {
+		d.add(&doc, SeverityError, "no clouds mapping found")
+		return d.list, nil
+	}
+
+	secureClouds, err := v.yamlOpts().LoadSecureCloudsYAML()
+	if err != nil {
+		d.add(&doc, SeverityError, "unable to load secure.yaml: %v", err)
+	}
+
+	for i := 0; i+1 < len(clouds.Content); i += 2 {
+		d.cloud = clouds.Content[i].Value
+		var secureCloud *Cloud
+		if c, ok := secureClouds[d.cloud]; ok {
+			secureCloud = &c
+		}
+		v.validateCloudNode(d, clouds.Content[i+1], secureCloud)
+	}
+	sortDiagnostics(d.list)
+
+	return d.list, nil
+}
+
+// ValidateCloud validates a cloud entry.
+func (v Validator) ValidateCloud(name string, cloud *Cloud) []Diagnostic {
+	var node yaml.Node
+	if err := node.Encode(cloud); err != nil {
+		return []Diagnostic{{Cloud: name, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	d := &diagnostics{cloud: name, positionless: true}
+	v.validateCloudNode(d, &node, nil)
+
+	return d.list
+}
+
+// diagnostics collects the diagnostics of a file.
+type diagnostics struct {
+	file         string
+	cloud        string
+	positionless bool
+	list         []Diagnostic
+}
+
+func (d *diagnostics) add(node *yaml.Node, severity Severity, format string, args ...interface{}) {
+	diagnostic := Diagnostic{
+		File:     d.file,
+		Cloud:    d.cloud,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if node != nil && !d.positionless {
+		diagnostic.Line = node.Line
+		diagnostic.Column = node.Column
+	}
+	d.list = append(d.list, diagnostic)
+}
+
+func (v Validator) yamlOpts() YAMLOptsBuilder {
+	if v.YAMLOpts != nil {
+		return v.YAMLOpts
+	}
+	return new(YAMLOpts)
+}
+
+// validateCloudNode validates the cloud entry merged with its secure.yaml
+// entry, if any.
+func (v Validator) validateCloudNode(d *diagnostics, node *yaml.Node, secureCloud *Cloud) {
+	if node.Kind != yaml.MappingNode {
+		d.add(node, SeverityError, "cloud entry must be a mapping")
+		return
+	}
+
+	checkKeys(d, node, reflect.TypeOf(Cloud{}), "")
+
+	var cloud Cloud
+	if err := node.Decode(&cloud); err != nil {
+		d.add(node, SeverityError, "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+		return
+	}
+
+	if secureCloud != nil {
+		merged, err := mergeClouds(*secureCloud, cloud)
+		if err != nil {
+			d.add(node, SeverityError, "unable to merge the secure.yaml entry: %v", err)
+			return
+		}
+		cloud = *merged
+	}
+
+	auth := cloud.AuthInfo
+	if auth == nil {
+		auth = new(AuthInfo)
+	}
+	authNode := mappingValue(node, "auth")
+	authKey := func(key string) *yaml.Node {
+		if i := mappingIndex(authNode, key); i >= 0 {
+			return authNode.Content[i]
+		}
+		return node
+	}
+
+	if auth.ProjectID != "" && auth.ProjectName != "" {
+		d.add(authKey("project_name"), SeverityError, "project_id and project_name are mutually exclusive")
+	}
+
+	// the profile may set the domain
+	if auth.ProjectName != "" && auth.ProjectDomainName == "" && auth.ProjectDomainID == "" &&
+		auth.DomainName == "" && auth.DomainID == "" && auth.DefaultDomain == "" &&
+		cloud.Profile == "" && cloud.Cloud == "" && !isIdentityV2(&cloud) {
+		d.add(authKey("project_name"), SeverityError, "project_name requires project_domain_name or project_domain_id")
+	}
+
+	if auth.Token != "" {
+		switch {
+		case auth.Password != "":
+			d.add(authKey("token"), SeverityError, "token and password are mutually exclusive")
+		case cloud.AuthType == AuthPassword || cloud.AuthType == AuthV2Password || cloud.AuthType == AuthV3Password:
+			d.add(authKey("token"), SeverityError, "token is ignored by the %s auth type", cloud.AuthType)
+		}
+	}
+
+	if auth.Password != "" {
+		for _, key := range []string{"password_file", "password_command"} {
+			if mappingIndex(authNode, key) >= 0 {
+				d.add(authKey(key), SeverityWarning, "%s is ignored, as password is set", key)
+			}
+		}
+	}
+
+	if auth.ApplicationCredentialName != "" && auth.Username == "" && auth.UserID == "" {
+		d.add(authKey("application_credential_name"), SeverityError, "application_credential_name requires username or user_id")
+	}
+
+	interfaceKeys := []string{"interface", "endpoint_type"}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if _, _, ok := serviceKey(key); ok && strings.HasSuffix(key, "_interface") {
+			interfaceKeys = append(interfaceKeys, key)
+		}
+	}
+	for _, key := range interfaceKeys {
+		if value := mappingValue(node, key); value != nil {
+			if !isValidInterface(value.Value) {
+				d.add(value, SeverityError, "invalid %s %q, must be one of %s or %s", key, value.Value,
+					strings.Join(validInterfaces[:len(validInterfaces)-1], ", "), validInterfaces[len(validInterfaces)-1])
+			}
+		}
+	}
+
+	for _, key := range []string{"cacert", "cert", "key"} {
+		if value := mappingValue(node, key); value != nil && value.Value != "" {
+			f, err := os.Open(value.Value)
+			if err != nil {
+				d.add(value, SeverityError, "%s file is not readable: %v", key, err)
+				continue
+			}
+			f.Close()
+		}
+	}
+
+	if profile := defaultIfEmpty(cloud.Profile, cloud.Cloud); profile != "" {
+		key := "profile"
+		if cloud.Profile == "" {
+			key = "cloud"
+		}
+
+		publicClouds, err := v.yamlOpts().LoadPublicCloudsYAML()
+		if err != nil {
+			d.add(mappingValue(node, key), SeverityError, "unable to load clouds-public.yaml: %v", err)
+		} else if _, ok := publicClouds[profile]; !ok {
+			d.add(mappingValue(node, key), SeverityError, "profile %s does not exist in clouds-public.yaml", profile)
+		}
+	}
+}
+
+func isValidInterface(value string) bool {
+	for _, v := range validInterfaces {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdentityV2 reports whether the cloud entry uses the Keystone v2 API,
+// which has no domains.
+func isIdentityV2(cloud *Cloud) bool {
+	if cloud.IdentityAPIVersion != "" {
+		return strings.HasPrefix(cloud.IdentityAPIVersion, "2")
+	}
+	if cloud.AuthType == AuthV2Password || cloud.AuthType == AuthV2Token {
+		return true
+	}
+	return cloud.AuthInfo != nil && strings.Contains(cloud.AuthInfo.AuthURL, "/v2.0")
+}
+
+// checkKeys reports the mapping keys, which do not match the yaml tags of the
+// type.
+func checkKeys(d *diagnostics, node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			// a region may be a plain name
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			field, ok := fields[key]
+			if !ok {
+				if t == reflect.TypeOf(Cloud{}) && isServiceKey(key) {
+					continue
+				}
+				d.add(node.Content[i], SeverityWarning, "unknown key %s%s", path, key)
+				continue
+			}
+			checkKeys(d, node.Content[i+1], field.Type, path+key+".")
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKeys(d, node.Content[i+1], t.Elem(), path+node.Content[i].Value+".")
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, n := range node.Content {
+			checkKeys(d, n, t.Elem(), fmt.Sprintf("%s%d.", path, i))
+		}
+	}
+}
+
+// yamlFields returns the struct fields by their yaml names.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// isServiceKey reports whether the key is a per-service key, e.g.
+// compute_api_version.
+func isServiceKey(key string) bool {
+	if _, _, ok := serviceKey(key); ok {
+		return true
+	}
+	for _, suffix := range otherServiceKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortDiagnostics sorts the diagnostics by their position.
+func sortDiagnostics(list []Diagnostic) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Line != list[j].Line {
+			return list[i].Line < list[j].Line
+		}
+		return list[i].Column < list[j].Column
+	})
+}
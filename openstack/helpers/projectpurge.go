@@ -2,8 +2,8 @@ package helpers
 
 import (
 	"context"
-	"fmt"
 
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/client"
 	"github.com/vnpaycloud-console/gophercloud/v2"
 	"github.com/vnpaycloud-console/gophercloud/v2/openstack/blockstorage/v3/snapshots"
 	"github.com/vnpaycloud-console/gophercloud/v2/openstack/blockstorage/v3/volumes"
@@ -72,19 +72,19 @@ func ProjectPurgeCompute(ctx context.Context, projectID string, purgeOpts Comput
 
 	allPages, err := servers.List(purgeOpts.Client, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding servers for project: " + projectID)
+		return newPurgeError(err, "Error finding servers for project: "+projectID)
 	}
 
 	allServers, err := servers.ExtractServers(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting servers for project: " + projectID)
+		return newPurgeError(err, "Error extracting servers for project: "+projectID)
 	}
 
 	if len(allServers) > 0 {
 		for _, server := range allServers {
 			err = servers.Delete(ctx, purgeOpts.Client, server.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting server: " + server.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting server: "+server.Name+" from project: "+projectID)
 			}
 		}
 	}
@@ -148,11 +148,11 @@ func clearBlockStorageVolumes(ctx context.Context, projectID string, storageClie
 	}
 	allPages, err := volumes.List(storageClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding volumes for project: " + projectID)
+		return newPurgeError(err, "Error finding volumes for project: "+projectID)
 	}
 	allVolumes, err := volumes.ExtractVolumes(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting volumes for project: " + projectID)
+		return newPurgeError(err, "Error extracting volumes for project: "+projectID)
 	}
 	if len(allVolumes) > 0 {
 		deleteOpts := volumes.DeleteOpts{
@@ -161,7 +161,7 @@ func clearBlockStorageVolumes(ctx context.Context, projectID string, storageClie
 		for _, volume := range allVolumes {
 			err = volumes.Delete(ctx, storageClient, volume.ID, deleteOpts).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting volume: " + volume.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting volume: "+volume.Name+" from project: "+projectID)
 			}
 		}
 	}
@@ -176,17 +176,17 @@ func clearBlockStorageSnaphosts(ctx context.Context, projectID string, storageCl
 	}
 	allPages, err := snapshots.List(storageClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding snapshots for project: " + projectID)
+		return newPurgeError(err, "Error finding snapshots for project: "+projectID)
 	}
 	allSnapshots, err := snapshots.ExtractSnapshots(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting snapshots for project: " + projectID)
+		return newPurgeError(err, "Error extracting snapshots for project: "+projectID)
 	}
 	if len(allSnapshots) > 0 {
 		for _, snaphost := range allSnapshots {
 			err = snapshots.Delete(ctx, storageClient, snaphost.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting snaphost: " + snaphost.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting snaphost: "+snaphost.Name+" from project: "+projectID)
 			}
 		}
 	}
@@ -207,7 +207,7 @@ func clearPortforwarding(ctx context.Context, networkClient *gophercloud.Service
 	for _, pf := range allPFs {
 		err := portforwarding.Delete(ctx, networkClient, fipID, pf.ID).ExtractErr()
 		if err != nil {
-			return fmt.Errorf("Error deleting floating IP port forwarding: " + pf.ID + " from project: " + projectID)
+			return newPurgeError(err, "Error deleting floating IP port forwarding: "+pf.ID+" from project: "+projectID)
 		}
 	}
 
@@ -220,11 +220,11 @@ func clearNetworkingFloatingIPs(ctx context.Context, projectID string, networkCl
 	}
 	allPages, err := floatingips.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding floating IPs for project: " + projectID)
+		return newPurgeError(err, "Error finding floating IPs for project: "+projectID)
 	}
 	allFloatings, err := floatingips.ExtractFloatingIPs(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting floating IPs for project: " + projectID)
+		return newPurgeError(err, "Error extracting floating IPs for project: "+projectID)
 	}
 	if len(allFloatings) > 0 {
 		for _, floating := range allFloatings {
@@ -236,7 +236,7 @@ func clearNetworkingFloatingIPs(ctx context.Context, projectID string, networkCl
 
 			err = floatingips.Delete(ctx, networkClient, floating.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting floating IP: " + floating.ID + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting floating IP: "+floating.ID+" from project: "+projectID)
 			}
 		}
 	}
@@ -251,11 +251,11 @@ func clearNetworkingPorts(ctx context.Context, projectID string, networkClient *
 
 	allPages, err := ports.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding ports for project: " + projectID)
+		return newPurgeError(err, "Error finding ports for project: "+projectID)
 	}
 	allPorts, err := ports.ExtractPorts(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting ports for project: " + projectID)
+		return newPurgeError(err, "Error extracting ports for project: "+projectID)
 	}
 	if len(allPorts) > 0 {
 		for _, port := range allPorts {
@@ -265,7 +265,7 @@ func clearNetworkingPorts(ctx context.Context, projectID string, networkClient *
 
 			err = ports.Delete(ctx, networkClient, port.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting port: " + port.ID + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting port: "+port.ID+" from project: "+projectID)
 			}
 		}
 	}
@@ -282,11 +282,11 @@ func getAllSubnets(ctx context.Context, projectID string, networkClient *gopherc
 
 	allPages, err := networks.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return subnets, fmt.Errorf("Error finding networks for project: " + projectID)
+		return subnets, newPurgeError(err, "Error finding networks for project: "+projectID)
 	}
 	allNetworks, err := networks.ExtractNetworks(allPages)
 	if err != nil {
-		return subnets, fmt.Errorf("Error extracting networks for project: " + projectID)
+		return subnets, newPurgeError(err, "Error extracting networks for project: "+projectID)
 	}
 	if len(allNetworks) > 0 {
 		for _, network := range allNetworks {
@@ -318,16 +318,16 @@ func clearNetworkingRouters(ctx context.Context, projectID string, networkClient
 	}
 	allPages, err := routers.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding routers for project: " + projectID)
+		return newPurgeError(err, "Error finding routers for project: "+projectID)
 	}
 	allRouters, err := routers.ExtractRouters(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting routers for project: " + projectID)
+		return newPurgeError(err, "Error extracting routers for project: "+projectID)
 	}
 
 	subnets, err := getAllSubnets(ctx, projectID, networkClient)
 	if err != nil {
-		return fmt.Errorf("Error fetching subnets project: " + projectID)
+		return newPurgeError(err, "Error fetching subnets project: "+projectID)
 	}
 
 	if len(allRouters) > 0 {
@@ -345,12 +345,12 @@ func clearNetworkingRouters(ctx context.Context, projectID string, networkClient
 
 			_, err := routers.Update(ctx, networkClient, router.ID, updateOpts).Extract()
 			if err != nil {
-				return fmt.Errorf("Error deleting router: " + router.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting router: "+router.Name+" from project: "+projectID)
 			}
 
 			err = routers.Delete(ctx, networkClient, router.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting router: " + router.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting router: "+router.Name+" from project: "+projectID)
 			}
 		}
 	}
@@ -365,17 +365,17 @@ func clearNetworkingNetworks(ctx context.Context, projectID string, networkClien
 
 	allPages, err := networks.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding networks for project: " + projectID)
+		return newPurgeError(err, "Error finding networks for project: "+projectID)
 	}
 	allNetworks, err := networks.ExtractNetworks(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting networks for project: " + projectID)
+		return newPurgeError(err, "Error extracting networks for project: "+projectID)
 	}
 	if len(allNetworks) > 0 {
 		for _, network := range allNetworks {
 			err = networks.Delete(ctx, networkClient, network.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting network: " + network.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting network: "+network.Name+" from project: "+projectID)
 			}
 		}
 	}
@@ -389,20 +389,47 @@ func clearNetworkingSecurityGroups(ctx context.Context, projectID string, networ
 	}
 	allPages, err := groups.List(networkClient, listOpts).AllPages(ctx)
 	if err != nil {
-		return fmt.Errorf("Error finding security groups for project: " + projectID)
+		return newPurgeError(err, "Error finding security groups for project: "+projectID)
 	}
 	allSecGroups, err := groups.ExtractGroups(allPages)
 	if err != nil {
-		return fmt.Errorf("Error extracting security groups for project: " + projectID)
+		return newPurgeError(err, "Error extracting security groups for project: "+projectID)
 	}
 	if len(allSecGroups) > 0 {
 		for _, group := range allSecGroups {
 			err = groups.Delete(ctx, networkClient, group.ID).ExtractErr()
 			if err != nil {
-				return fmt.Errorf("Error deleting security group: " + group.Name + " from project: " + projectID)
+				return newPurgeError(err, "Error deleting security group: "+group.Name+" from project: "+projectID)
 			}
 		}
 	}
 
 	return nil
 }
+
+// purgeError is returned by the purge functions. It contains the OpenStack
+// request ID of the failed request, when known, and wraps the original error.
+type purgeError struct {
+	message   string
+	requestID string
+	err       error
+}
+
+func newPurgeError(err error, message string) error {
+	return purgeError{
+		message:   message,
+		requestID: client.RequestIDFromError(err),
+		err:       err,
+	}
+}
+
+func (e purgeError) Error() string {
+	if e.requestID == "" {
+		return e.message
+	}
+	return e.message + " (request ID: " + e.requestID + ")"
+}
+
+func (e purgeError) Unwrap() error {
+	return e.err
+}
@@ -58,6 +58,10 @@ type Config struct {
 	swClient      *gophercloud.ServiceClient
 	swAuthFailed  error
 
+	// endpointOverrides are the EndpointOverrides merged with the ones of
+	// the cloud entry.
+	endpointOverrides map[string]interface{}
+
 	TerraformVersion string
 	SDKVersion       string
 	EnableLogger     bool
@@ -132,6 +136,8 @@ func (c *Config) LoadAndValidate(ctx context.Context) error {
 			v := (!*cloud.Verify)
 			c.Insecure = &v
 		}
+
+		c.endpointOverrides = mergeEndpointOverrides(c.EndpointOverrides, cloud)
 	} else {
 		authInfo := &clientconfig.AuthInfo{
 			AuthURL:                     c.IdentityEndpoint,
@@ -245,10 +251,67 @@ func (c *Config) Authenticate(ctx context.Context) error {
 	return nil
 }
 
+// cloudEndpointOverrides maps the services of EndpointOverrides to the
+// services of the per-service keys of a clouds.yaml cloud entry. It covers
+// all the services supported by clientconfig.NewServiceClient, along with
+// the aliases used by terraform, e.g. volumev3 or octavia.
+var cloudEndpointOverrides = map[string]string{
+	"baremetal":               "baremetal",
+	"baremetal-introspection": "baremetal-introspection",
+	"compute":                 "compute",
+	"container":               "container",
+	"container-infra":         "container-infra",
+	"database":                "database",
+	"dns":                     "dns",
+	"gnocchi":                 "gnocchi",
+	"metric":                  "gnocchi",
+	"identity":                "identity",
+	"image":                   "image",
+	"key-manager":             "key-manager",
+	"load-balancer":           "load-balancer",
+	"octavia":                 "load-balancer",
+	"messaging":               "messaging",
+	"network":                 "network",
+	"object-store":            "object-store",
+	"orchestration":           "orchestration",
+	"placement":               "placement",
+	"sharev2":                 "sharev2",
+	"volume":                  "volume",
+	"volumev2":                "volume",
+	"volumev3":                "volume",
+	"workflowv2":              "workflowv2",
+}
+
+// mergeEndpointOverrides returns a copy of the endpoint overrides of the
+// provider merged with the ones of the cloud entry. The endpoint overrides of
+// the cloud entry don't replace the ones of the provider.
+func mergeEndpointOverrides(overrides map[string]interface{}, cloud *clientconfig.Cloud) map[string]interface{} {
+	merged := make(map[string]interface{}, len(overrides))
+	for k, v := range overrides {
+		merged[k] = v
+	}
+
+	for service, name := range cloudEndpointOverrides {
+		if _, ok := merged[service]; ok {
+			continue
+		}
+		if v := cloud.Service(name).EndpointOverride; v != "" {
+			merged[service] = gophercloud.NormalizeURL(v)
+		}
+	}
+
+	return merged
+}
+
 // DetermineEndpoint is a helper method to determine if the user wants to
 // override an endpoint returned from the catalog.
 func (c *Config) DetermineEndpoint(client *gophercloud.ServiceClient, eo gophercloud.EndpointOpts, service string) (*gophercloud.ServiceClient, error) {
-	v, ok := c.EndpointOverrides[service]
+	overrides := c.endpointOverrides
+	if overrides == nil {
+		overrides = c.EndpointOverrides
+	}
+
+	v, ok := overrides[service]
 	if !ok {
 		return client, nil
 	}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vnpaycloud-console/gophercloud-utils/v2/openstack/clientconfig"
+)
+
+func TestMergeEndpointOverrides(t *testing.T) {
+	cloud := &clientconfig.Cloud{
+		Services: map[string]clientconfig.ServiceOpts{
+			"compute": {EndpointOverride: "https://cloud.example.com/compute/v2.1"},
+			"volume":  {EndpointOverride: "https://cloud.example.com/volume/v3"},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		overrides map[string]interface{}
+		expected  map[string]interface{}
+	}{
+		{
+			name: "cloud entry only",
+			expected: map[string]interface{}{
+				"compute":  "https://cloud.example.com/compute/v2.1/",
+				"volume":   "https://cloud.example.com/volume/v3/",
+				"volumev2": "https://cloud.example.com/volume/v3/",
+				"volumev3": "https://cloud.example.com/volume/v3/",
+			},
+		},
+		{
+			name: "provider wins",
+			overrides: map[string]interface{}{
+				"compute":  "https://provider.example.com/compute/v2.1/",
+				"volumev3": "block-storage",
+				"network":  "https://provider.example.com/network/",
+			},
+			expected: map[string]interface{}{
+				"compute":  "https://provider.example.com/compute/v2.1/",
+				"network":  "https://provider.example.com/network/",
+				"volume":   "https://cloud.example.com/volume/v3/",
+				"volumev2": "https://cloud.example.com/volume/v3/",
+				"volumev3": "block-storage",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var original map[string]interface{}
+		if tc.overrides != nil {
+			original = make(map[string]interface{}, len(tc.overrides))
+			for k, v := range tc.overrides {
+				original[k] = v
+			}
+		}
+
+		merged := mergeEndpointOverrides(tc.overrides, cloud)
+		if !reflect.DeepEqual(tc.expected, merged) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, merged)
+		}
+
+		// the overrides of the provider are not modified
+		if !reflect.DeepEqual(original, tc.overrides) {
+			t.Errorf("%s: the overrides were modified: %v", tc.name, tc.overrides)
+		}
+	}
+}